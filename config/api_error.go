@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/steadybit/extension-dynatrace/types"
+)
+
+// ApiError is a response of the Dynatrace API with an unexpected status code. If the body contains the Dynatrace
+// error envelope, its message and constraint violations are parsed. The settings API wraps the envelope into an array
+// with one item per settings object, then the first error is used.
+type ApiError struct {
+	Operation            string
+	StatusCode           int
+	Message              string
+	ConstraintViolations []types.ConstraintViolation
+	// Body is the raw response body, set if it doesn't contain the error envelope
+	Body string
+}
+
+func newApiError(operation string, response *http.Response, body []byte) *ApiError {
+	apiErr := &ApiError{Operation: operation, StatusCode: response.StatusCode}
+	if envelope := parseErrorEnvelope(body); envelope != nil {
+		apiErr.withError(envelope)
+	} else {
+		apiErr.Body = string(body)
+	}
+	return apiErr
+}
+
+func (e *ApiError) withError(envelope *types.Error) *ApiError {
+	e.Message = envelope.Message
+	e.ConstraintViolations = envelope.ConstraintViolations
+	return e
+}
+
+func parseErrorEnvelope(body []byte) *types.Error {
+	var envelope types.ErrorEnvelope
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error != nil {
+		return envelope.Error
+	}
+	var envelopes []types.ErrorEnvelope
+	if err := json.Unmarshal(body, &envelopes); err == nil {
+		for _, item := range envelopes {
+			if item.Error != nil {
+				return item.Error
+			}
+		}
+	}
+	return nil
+}
+
+// Summary describes the error without the operation and status code, like
+// "Constraints violated. entitySelector: Unknown entity type FOO".
+func (e *ApiError) Summary() string {
+	if e.Message == "" && len(e.ConstraintViolations) == 0 {
+		return e.Body
+	}
+	parts := make([]string, 0, len(e.ConstraintViolations)+1)
+	if e.Message != "" {
+		parts = append(parts, strings.TrimSpace(e.Message))
+	}
+	for _, violation := range e.ConstraintViolations {
+		if violation.Path != "" {
+			parts = append(parts, fmt.Sprintf("%s: %s", violation.Path, violation.Message))
+		} else {
+			parts = append(parts, violation.Message)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("%s request to Dynatrace failed with status code %d: %s", e.Operation, e.StatusCode, e.Summary())
+}
+
+// Retryable tells whether the request may succeed when sent again. Rate limiting and unavailable gateways are
+// transient, all other errors (bad requests, missing permissions, unknown objects) are permanent.
+func (e *ApiError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || isTransientStatus(e.StatusCode)
+}
+
+// IsRetryable tells whether err is an ApiError that may succeed when the request is sent again.
+func IsRetryable(err error) bool {
+	var apiErr *ApiError
+	return errors.As(err, &apiErr) && apiErr.Retryable()
+}
+
+func isTransientStatus(code int) bool {
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// IsPermanent tells whether err is an ApiError that will fail again no matter how often the request is sent, like a
+// bad request. Rate limiting and server errors are not permanent.
+func IsPermanent(err error) bool {
+	var apiErr *ApiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+		apiErr.StatusCode != http.StatusTooManyRequests && apiErr.StatusCode != http.StatusRequestTimeout
+}
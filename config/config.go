@@ -7,20 +7,21 @@ package config
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-dynatrace/entitymapping"
+	"github.com/steadybit/extension-dynatrace/extmetrics"
 	"github.com/steadybit/extension-dynatrace/types"
 )
 
@@ -36,36 +37,267 @@ type Specification struct {
 	UiProblemsPath string `json:"uiProblemsPath" split_words:"true" default:"/apps/dynatrace.classic.problems/#problems/problemdetails"`
 	// The Dynatrace API Token
 	ApiToken string `json:"apiToken" split_words:"true" required:"true"`
+	// The Dynatrace Platform Base Url, like 'https://{your-environment-id}.apps.dynatrace.com/platform'. Used by the platform APIs, which require OAuth.
+	PlatformBaseUrl string `json:"platformBaseUrl" split_words:"true"`
+	// The client ID of the OAuth client used for the Dynatrace platform APIs
+	OAuthClientId string `json:"oauthClientId" envconfig:"OAUTH_CLIENT_ID"`
+	// The client secret of the OAuth client used for the Dynatrace platform APIs
+	OAuthClientSecret string `json:"oauthClientSecret" envconfig:"OAUTH_CLIENT_SECRET"`
+	// The account URN the OAuth client belongs to, like 'urn:dtaccount:{your-account-uuid}'
+	OAuthAccountUrn string `json:"oauthAccountUrn" envconfig:"OAUTH_ACCOUNT_URN"`
+	// Space separated scopes requested for the OAuth token. If empty, all scopes of the OAuth client are granted.
+	OAuthScopes string `json:"oauthScopes" envconfig:"OAUTH_SCOPES"`
+	// The token endpoint of the Dynatrace SSO
+	OAuthTokenUrl string `json:"oauthTokenUrl" envconfig:"OAUTH_TOKEN_URL" default:"https://sso.dynatrace.com/sso/oauth2/token"`
 	// To not check certificate for on-prem dynatrace installations
 	InsecureSkipVerify bool `json:"insecureSkipVerify" split_words:"true" default:"false"`
+	// Timeout of a single request to the Dynatrace API
+	HttpClientTimeout time.Duration `json:"httpClientTimeout" split_words:"true" default:"30s"`
+	// Timeouts of a single request per operation, like 'getProblems:10s,postEvent:5s'. Operations without a timeout use HttpClientTimeout.
+	ApiOperationTimeouts map[string]time.Duration `json:"apiOperationTimeouts" split_words:"true"`
+	// Maximum number of idle (keep-alive) connections kept in the pool
+	HttpMaxIdleConns int `json:"httpMaxIdleConns" split_words:"true" default:"100"`
+	// Maximum number of idle (keep-alive) connections kept in the pool per host
+	HttpMaxIdleConnsPerHost int `json:"httpMaxIdleConnsPerHost" split_words:"true" default:"10"`
+	// How long an idle connection is kept in the pool before it is closed
+	HttpIdleConnTimeout time.Duration `json:"httpIdleConnTimeout" split_words:"true" default:"90s"`
+	// Maximum time to wait for a TLS handshake
+	HttpTlsHandshakeTimeout time.Duration `json:"httpTlsHandshakeTimeout" split_words:"true" default:"10s"`
+	// How often the certificates in SSL_CERT_DIR are checked for changes
+	HttpCaReloadInterval time.Duration `json:"httpCaReloadInterval" split_words:"true" default:"1m"`
+	// Maximum number of pages read when a Dynatrace API result is paginated (entities, problems)
+	ApiMaxPages int `json:"apiMaxPages" split_words:"true" default:"20"`
+	// How often a failed request to the Dynatrace API is retried. 0 disables retries.
+	ApiMaxRetries int `json:"apiMaxRetries" split_words:"true" default:"3"`
+	// Total time a request including all retries may take
+	ApiRetryBudget time.Duration `json:"apiRetryBudget" split_words:"true" default:"30s"`
+	// Wait time before the first retry, doubled on each further retry
+	ApiRetryInitialBackoff time.Duration `json:"apiRetryInitialBackoff" split_words:"true" default:"500ms"`
+	// Upper bound of the wait time between two retries
+	ApiRetryMaxBackoff time.Duration `json:"apiRetryMaxBackoff" split_words:"true" default:"10s"`
+	// Also retry POST requests (event ingest, maintenance window creation) on errors other than 429. A request that already reached Dynatrace may then be applied twice.
+	ApiRetryPost bool `json:"apiRetryPost" split_words:"true" default:"false"`
+	// Requests per second per API family, like 'events:10,problems:5'. Families are events, entities, problems and settings. 0 disables the limit.
+	ApiRateLimits map[string]float64 `json:"apiRateLimits" split_words:"true"`
+	// Number of requests per API family that may be sent at once before the rate limit applies
+	ApiRateLimitBurst int `json:"apiRateLimitBurst" split_words:"true" default:"10"`
+	// Maximum time a request waits for the rate limit before it fails
+	ApiRateLimitMaxWait time.Duration `json:"apiRateLimitMaxWait" split_words:"true" default:"10s"`
+	// Maximum number of events waiting for delivery to Dynatrace. Further events are dropped.
+	EventQueueSize int `json:"eventQueueSize" split_words:"true" default:"1000"`
+	// Directory to persist the events waiting for delivery, so they survive restarts. If empty, they are kept in memory only.
+	EventQueueDir string `json:"eventQueueDir" split_words:"true"`
+	// How often the delivery of an event is attempted before it is dropped
+	EventQueueMaxAttempts int `json:"eventQueueMaxAttempts" split_words:"true" default:"10"`
+	// Events older than this are dropped instead of delivered
+	EventQueueMaxAge time.Duration `json:"eventQueueMaxAge" split_words:"true" default:"1h"`
+	// Wait time before the second delivery attempt, doubled on each further attempt
+	EventQueueInitialBackoff time.Duration `json:"eventQueueInitialBackoff" split_words:"true" default:"1s"`
+	// Upper bound of the wait time between two delivery attempts
+	EventQueueMaxBackoff time.Duration `json:"eventQueueMaxBackoff" split_words:"true" default:"1m"`
+	// How long pending events are delivered on shutdown
+	EventQueueFlushTimeout time.Duration `json:"eventQueueFlushTimeout" split_words:"true" default:"20s"`
+	// Number of workers preparing incoming events for delivery. Events of the same experiment execution are handled by the same worker, in order.
+	EventWorkers int `json:"eventWorkers" split_words:"true" default:"4"`
+	// Maximum number of incoming events waiting for a worker. If it is reached, the event listener blocks until a worker is free.
+	EventWorkerBacklog int `json:"eventWorkerBacklog" split_words:"true" default:"1000"`
+	// Send a single event spanning an experiment or attack instead of two point events for its start and end. The event is opened when it starts and closed when it ends.
+	EventDurations bool `json:"eventDurations" split_words:"true" default:"false"`
+	// Kinds of actions whose targets are sent as events, like 'attack', 'check' and 'load_test'
+	EventActionKinds []string `json:"eventActionKinds" split_words:"true" default:"attack"`
+	// Send an event with the outcome of each ended step of these action kinds
+	EventStepCompleted bool `json:"eventStepCompleted" split_words:"true" default:"false"`
+	// Time after which Dynatrace closes an event of an experiment or attack whose end wasn't received, at most MaxEventDurationTimeout
+	EventDurationTimeout time.Duration `json:"eventDurationTimeout" split_words:"true" default:"2h"`
+	// Dynatrace event type per Steadybit event and execution state, like 'experiment.started:CUSTOM_ANNOTATION,experiment.completed/failed:ERROR_EVENT'. Events without a mapping are sent as CUSTOM_INFO.
+	EventTypes map[string]string `json:"eventTypes" split_words:"true"`
+	// Title and additional properties of the events per Steadybit event as JSON object, see EventTemplates
+	EventTemplates EventTemplates `json:"eventTemplates" split_words:"true"`
+	// Events are only sent for executions matching one of these rules, as JSON array, see EventFilter
+	EventAllow EventFilters `json:"eventAllow" split_words:"true"`
+	// Events aren't sent for executions matching one of these rules, as JSON array, see EventFilter
+	EventDeny EventFilters `json:"eventDeny" split_words:"true"`
+	// JSON file with rules mapping Steadybit targets to Dynatrace entities, see entitymapping.File. The built-in rules are used if empty.
+	EntityMappingFile string `json:"entityMappingFile" split_words:"true"`
+	// Attach events to all entities matching a selector, and map target attributes with multiple values to all their entities. By default, ambiguous entities are skipped.
+	EventAttachAllEntities bool `json:"eventAttachAllEntities" split_words:"true" default:"false"`
+	// Maximum number of entities an event is attached to, or referenced per property, if EventAttachAllEntities is enabled
+	EventMaxEntities int `json:"eventMaxEntities" split_words:"true" default:"10"`
+	// Maximum number of entities the event of an ended experiment is attached to. The event is attached to the entities of all targets of the experiment.
+	EventMaxExperimentEntities int `json:"eventMaxExperimentEntities" split_words:"true" default:"100"`
+	// Time entity lookups are collected to resolve the lookups of entities of the same type in a single request
+	EntityLookupBatchWindow time.Duration `json:"entityLookupBatchWindow" split_words:"true" default:"50ms"`
+	// Time a lookup finding no entity is cached, so that new entities are found quickly
+	EntityCacheNegativeTtl time.Duration `json:"entityCacheNegativeTtl" split_words:"true" default:"1m"`
+	// Time the step executions of an experiment are remembered if its end isn't received
+	EventStateTtl time.Duration `json:"eventStateTtl" split_words:"true" default:"24h"`
+	// File to persist the step executions of running experiments in, so they survive restarts
+	EventStateFile string `json:"eventStateFile" split_words:"true"`
+	// Kubernetes ConfigMap to persist the step executions of running experiments in, as 'name' or 'namespace/name'. Requires the permissions to get, create and update it.
+	EventStateConfigMap string `json:"eventStateConfigMap" split_words:"true"`
+	// Where the experiment events are sent: 'events' (Dynatrace events), 'bizevents' (Grail business events, requires OAuth) or 'both'
+	EventOutput string `json:"eventOutput" split_words:"true" default:"events"`
+	// Write metrics about the experiments to Dynatrace, like executions by state and attack durations
+	MetricIngest bool `json:"metricIngest" split_words:"true" default:"false"`
+	// Interval in which the collected metrics are sent to Dynatrace
+	MetricIngestInterval time.Duration `json:"metricIngestInterval" split_words:"true" default:"30s"`
+	// Look up the scopes of the API token at startup and disable the actions and event listeners whose scopes are missing
+	ValidateTokenScopes bool `json:"validateTokenScopes" split_words:"true" default:"true"`
+	// Name of the tenant configured by the settings above. It is used for events matching no other tenant and is the default of the tenant parameter of the actions.
+	DefaultTenantName string `json:"defaultTenantName" split_words:"true" default:"default"`
+	// Additional Dynatrace tenants as JSON array, see Tenant
+	Tenants TenantList `json:"tenants"`
+
+	tenant   string
+	client   *pooledClient
+	oauth    *oauthTokenSource
+	limiters *rateLimiters
 }
 
+const defaultApiMaxPages = 20
+
+// Names of the Dynatrace API operations, used to configure timeouts per operation
+const (
+	OperationPostEvent               = "postEvent"
+	OperationGetEntities             = "getEntities"
+	OperationCreateMaintenanceWindow = "createMaintenanceWindow"
+	OperationDeleteMaintenanceWindow = "deleteMaintenanceWindow"
+	OperationGetProblems             = "getProblems"
+	OperationLookupToken             = "lookupToken"
+	OperationIngestMetrics           = "ingestMetrics"
+	OperationIngestBizEvent          = "ingestBizEvent"
+	OperationVerifyQuery             = "verifyQuery"
+)
+
+var Operations = []string{OperationPostEvent, OperationGetEntities, OperationCreateMaintenanceWindow, OperationDeleteMaintenanceWindow, OperationGetProblems, OperationLookupToken, OperationIngestMetrics, OperationIngestBizEvent, OperationVerifyQuery}
+
+// operationContentTypes holds the operations whose request body isn't JSON
+var operationContentTypes = map[string]string{
+	OperationIngestMetrics:  "text/plain; charset=utf-8",
+	OperationIngestBizEvent: "application/cloudevent+json",
+}
+
+// Outputs of the event listeners, see EventOutput
+const (
+	EventOutputEvents    = "events"
+	EventOutputBizEvents = "bizevents"
+	EventOutputBoth      = "both"
+)
+
 var (
 	Config Specification
 )
 
+// MaxEventDurationTimeout is the longest timeout Dynatrace accepts for an event
+const MaxEventDurationTimeout = 6 * time.Hour
+
 func ParseConfiguration() {
 	err := envconfig.Process("steadybit_extension", &Config)
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Failed to parse configuration from environment.")
 	}
+	Config.InitHttpClient()
+	tenantsErr = initTenants()
+	entityRules, entityRulesErr = entitymapping.Load(Config.EntityMappingFile)
+}
+
+var (
+	// tenantsErr holds the problems found in the tenant configuration, they are reported by ValidateConfiguration
+	tenantsErr error
+	// entityRules map Steadybit targets to Dynatrace entities, entityRulesErr is reported by ValidateConfiguration
+	entityRules    *entitymapping.Rules
+	entityRulesErr error
+)
+
+// EntityRules returns the rules mapping Steadybit targets to Dynatrace entities.
+func EntityRules() *entitymapping.Rules {
+	if entityRules == nil {
+		return entitymapping.Defaults()
+	}
+	return entityRules
 }
 
-func ValidateConfiguration() {
-	// You may optionally validate the configuration here.
+// ValidateConfiguration checks the configuration and looks up the scopes of the API token. It returns false if the
+// extension can't work with the configuration, e.g. because Dynatrace rejected the token.
+func ValidateConfiguration() bool {
+	for operation := range Config.ApiOperationTimeouts {
+		if !slices.Contains(Operations, operation) {
+			log.Warn().Str("operation", operation).Strs("operations", Operations).Msg("Ignoring timeout for unknown operation.")
+		}
+	}
+	for family := range Config.ApiRateLimits {
+		if !slices.Contains(Families, family) {
+			log.Warn().Str("family", family).Strs("families", Families).Msg("Ignoring rate limit for unknown API family.")
+		}
+	}
+	if Config.EventDurationTimeout > MaxEventDurationTimeout {
+		log.Warn().Dur("eventDurationTimeout", Config.EventDurationTimeout).Dur("max", MaxEventDurationTimeout).Msg("Event duration timeout exceeds the maximum timeout of Dynatrace events, using the maximum.")
+	}
+	for event, eventType := range Config.EventTypes {
+		if !slices.Contains(types.EventTypes, eventType) {
+			log.Error().Str("event", event).Str("eventType", eventType).Strs("eventTypes", types.EventTypes).Msg("Invalid Dynatrace event type.")
+			return false
+		}
+	}
+	switch Config.EventOutput {
+	case "", EventOutputEvents:
+	case EventOutputBizEvents, EventOutputBoth:
+		if !Config.HasOAuthCredentials() {
+			log.Error().Str("eventOutput", Config.EventOutput).Msg("Business events require the OAuth client id, client secret and account urn.")
+			return false
+		}
+	default:
+		log.Error().Str("eventOutput", Config.EventOutput).Msg("Invalid event output, must be 'events', 'bizevents' or 'both'.")
+		return false
+	}
+	if tenantsErr != nil {
+		log.Error().Err(tenantsErr).Msg("Invalid tenant configuration.")
+		return false
+	}
+	if entityRulesErr != nil {
+		log.Error().Err(entityRulesErr).Str("file", Config.EntityMappingFile).Msg("Invalid entity mapping rules.")
+		return false
+	}
+	valid := true
+	for _, spec := range allTenants() {
+		valid = spec.validate(context.Background()) && valid
+	}
+	return valid
 }
 
-func (s *Specification) PostEvent(_ context.Context, event types.EventIngest) (*types.EventIngestResults, *http.Response, error) {
+// validate checks the OAuth credentials and the API token of a single tenant.
+func (s *Specification) validate(ctx context.Context) bool {
+	if s.OAuthClientId != "" || s.OAuthClientSecret != "" || s.OAuthAccountUrn != "" {
+		if !s.HasOAuthCredentials() {
+			log.Error().Str("tenant", s.tenant).Msg("Incomplete OAuth configuration, the client id, client secret and account urn are required.")
+			return false
+		}
+		if s.PlatformBaseUrl != "" {
+			s.validateOAuth(ctx)
+		} else if _, err := s.oauthTokens().get(ctx); err != nil {
+			log.Error().Str("tenant", s.tenant).Err(err).Msg("Failed to fetch an OAuth token from the Dynatrace SSO. Please check the OAuth client credentials.")
+		}
+	}
+	if !s.ValidateTokenScopes {
+		return true
+	}
+	return s.validateToken(ctx)
+}
+
+func (s *Specification) PostEvent(ctx context.Context, event types.EventIngest) (*types.EventIngestResults, *http.Response, error) {
 	b, err := json.Marshal(event)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to marshal event")
 		return nil, nil, err
 	}
 
-	responseBody, response, err := s.do(fmt.Sprintf("%s/v2/events/ingest", s.ApiBaseUrl), "POST", b)
+	responseBody, response, err := s.do(ctx, OperationPostEvent, fmt.Sprintf("%s/v2/events/ingest", s.ApiBaseUrl), "POST", b)
 	if err != nil {
 		return nil, response, err
 	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, response, newApiError(OperationPostEvent, response, responseBody)
+	}
 
 	var result types.EventIngestResults
 	if responseBody != nil {
@@ -78,25 +310,80 @@ func (s *Specification) PostEvent(_ context.Context, event types.EventIngest) (*
 	return &result, response, err
 }
 
-func (s *Specification) GetEntities(_ context.Context, entitySelector string) (*types.EntitiesList, *http.Response, error) {
-	responseBody, response, err := s.do(fmt.Sprintf("%s/v2/entities?entitySelector=%s", s.ApiBaseUrl, url.QueryEscape(entitySelector)), "GET", nil)
+// IngestMetrics writes metrics in the line protocol, one per line. Dynatrace accepts the valid lines even if others
+// are invalid, those are reported in the result.
+func (s *Specification) IngestMetrics(ctx context.Context, lines []string) (*types.MetricIngestResult, *http.Response, error) {
+	responseBody, response, err := s.do(ctx, OperationIngestMetrics, fmt.Sprintf("%s/v2/metrics/ingest", s.ApiBaseUrl), "POST", []byte(strings.Join(lines, "\n")))
 	if err != nil {
 		return nil, response, err
 	}
 
+	var result types.MetricIngestResult
+	if len(responseBody) > 0 {
+		if err := json.Unmarshal(responseBody, &result); err != nil {
+			log.Debug().Err(err).Str("body", string(responseBody)).Msg("Failed to parse metric ingest response")
+		}
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &result, response, newApiError(OperationIngestMetrics, response, responseBody)
+	}
+	return &result, response, nil
+}
+
+// IngestBizEvent sends a business event to Grail. The bizevents API requires an OAuth token with the scope
+// storage:events:write.
+func (s *Specification) IngestBizEvent(ctx context.Context, event types.BizEvent) (*http.Response, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to marshal business event")
+		return nil, err
+	}
+
+	responseBody, response, err := s.do(ctx, OperationIngestBizEvent, fmt.Sprintf("%s/v2/bizevents/ingest", s.ApiBaseUrl), "POST", b)
+	if err != nil {
+		return response, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response, newApiError(OperationIngestBizEvent, response, responseBody)
+	}
+	return response, nil
+}
+
+// GetEntities returns all entities matching the entity selector. The nextPageKey is followed until all pages are
+// read, but at most ApiMaxPages pages are requested.
+func (s *Specification) GetEntities(ctx context.Context, entitySelector string) (*types.EntitiesList, *http.Response, error) {
+	requestUrl := fmt.Sprintf("%s/v2/entities?entitySelector=%s", s.ApiBaseUrl, url.QueryEscape(entitySelector))
+
 	var result types.EntitiesList
-	if responseBody != nil {
-		err = json.Unmarshal(responseBody, &result)
+	for page := 1; ; page++ {
+		responseBody, response, err := s.do(ctx, OperationGetEntities, requestUrl, "GET", nil)
 		if err != nil {
-			log.Error().Err(err).Str("body", string(responseBody)).Msgf("Failed to parse body")
 			return nil, response, err
 		}
-	}
+		if response.StatusCode != 200 {
+			return nil, response, newApiError(OperationGetEntities, response, responseBody)
+		}
 
-	return &result, response, err
+		var pageResult types.EntitiesList
+		if responseBody != nil {
+			err = json.Unmarshal(responseBody, &pageResult)
+			if err != nil {
+				log.Error().Err(err).Str("body", string(responseBody)).Msgf("Failed to parse body")
+				return nil, response, err
+			}
+		}
+
+		result.Entities = append(result.Entities, pageResult.Entities...)
+		result.TotalCount = pageResult.TotalCount
+		result.PageSize = len(result.Entities)
+		if !s.hasNextPage(pageResult.NextPageKey, page, "entities", len(result.Entities), pageResult.TotalCount) {
+			return &result, response, nil
+		}
+		requestUrl = fmt.Sprintf("%s/v2/entities?nextPageKey=%s", s.ApiBaseUrl, url.QueryEscape(*pageResult.NextPageKey))
+	}
 }
 
-func (s *Specification) CreateMaintenanceWindow(_ context.Context, maintenanceWindow types.CreateMaintenanceWindowRequest) (*string, *http.Response, error) {
+func (s *Specification) CreateMaintenanceWindow(ctx context.Context, maintenanceWindow types.CreateMaintenanceWindowRequest) (*string, *http.Response, error) {
 	objects := []types.CreateMaintenanceWindowRequest{maintenanceWindow}
 
 	b, err := json.Marshal(objects)
@@ -105,14 +392,14 @@ func (s *Specification) CreateMaintenanceWindow(_ context.Context, maintenanceWi
 		return nil, nil, err
 	}
 
-	responseBody, response, err := s.do(fmt.Sprintf("%s/v2/settings/objects", s.ApiBaseUrl), "POST", b)
+	responseBody, response, err := s.do(ctx, OperationCreateMaintenanceWindow, fmt.Sprintf("%s/v2/settings/objects", s.ApiBaseUrl), "POST", b)
 	if err != nil {
 		return nil, response, err
 	}
 
 	if response.StatusCode != 200 {
-		log.Error().Int("code", response.StatusCode).Err(err).Msgf("Unexpected response %+v", string(responseBody))
-		return nil, response, fmt.Errorf("unexpected response code %d: %+v", response.StatusCode, string(responseBody))
+		log.Error().Int("code", response.StatusCode).Msgf("Unexpected response %+v", string(responseBody))
+		return nil, response, newApiError(OperationCreateMaintenanceWindow, response, responseBody)
 	}
 
 	var result []types.CreateMaintenanceWindowResponse
@@ -126,95 +413,160 @@ func (s *Specification) CreateMaintenanceWindow(_ context.Context, maintenanceWi
 
 	if len(result) == 1 && result[0].Code == 200 {
 		return &result[0].ObjectId, response, err
+	} else if len(result) == 1 && result[0].Error != nil {
+		log.Error().Int("code", result[0].Code).Msgf("Unexpected response %+v", string(responseBody))
+		return nil, response, (&ApiError{Operation: OperationCreateMaintenanceWindow, StatusCode: result[0].Code}).withError(result[0].Error)
 	} else {
 		log.Error().Err(err).Msgf("Unexpected response %+v", result)
 		return nil, response, errors.New("unexpected response")
 	}
 }
 
-func (s *Specification) DeleteMaintenanceWindow(_ context.Context, maintenanceWindowId string) (*http.Response, error) {
-	_, response, err := s.do(fmt.Sprintf("%s/v2/settings/objects/%s", s.ApiBaseUrl, maintenanceWindowId), "DELETE", nil)
+func (s *Specification) DeleteMaintenanceWindow(ctx context.Context, maintenanceWindowId string) (*http.Response, error) {
+	responseBody, response, err := s.do(ctx, OperationDeleteMaintenanceWindow, fmt.Sprintf("%s/v2/settings/objects/%s", s.ApiBaseUrl, maintenanceWindowId), "DELETE", nil)
+	if err == nil && (response.StatusCode < 200 || response.StatusCode > 299) {
+		return response, newApiError(OperationDeleteMaintenanceWindow, response, responseBody)
+	}
 	return response, err
 }
 
-func (s *Specification) GetProblems(_ context.Context, from time.Time, entitySelector *string) ([]types.Problem, *http.Response, error) {
+// GetProblems returns all open problems, optionally filtered by an entity selector. The nextPageKey is followed until
+// all pages are read, but at most ApiMaxPages pages are requested.
+func (s *Specification) GetProblems(ctx context.Context, from time.Time, entitySelector *string) ([]types.Problem, *http.Response, error) {
 	requestUrl := fmt.Sprintf("%s/v2/problems?problemSelector=status(\"OPEN\")&pageSize=500", s.ApiBaseUrl)
 	if entitySelector != nil {
 		requestUrl = fmt.Sprintf("%s&entitySelector=%s", requestUrl, url.QueryEscape(*entitySelector))
 	}
 
-	responseBody, response, err := s.do(requestUrl, "GET", nil)
-	if err != nil {
-		return nil, response, err
-	}
-
-	if response.StatusCode != 200 {
-		log.Error().Int("code", response.StatusCode).Err(err).Msgf("Unexpected response %+v", string(responseBody))
-		return nil, response, fmt.Errorf("unexpected response code %d: %+v", response.StatusCode, string(responseBody))
-	}
-
-	var result types.GetProblemsResponse
-	if responseBody != nil {
-		err = json.Unmarshal(responseBody, &result)
+	var problems []types.Problem
+	for page := 1; ; page++ {
+		responseBody, response, err := s.do(ctx, OperationGetProblems, requestUrl, "GET", nil)
 		if err != nil {
-			log.Error().Err(err).Str("body", string(responseBody)).Msgf("Failed to parse body")
 			return nil, response, err
 		}
-	}
-
-	return result.Problems, response, err
-}
 
-func (s *Specification) do(url string, method string, body []byte) ([]byte, *http.Response, error) {
-	// Build a dedicated transport with optional extra CAs
-	rootPool, errPool := x509.SystemCertPool()
-	if rootPool == nil || errPool != nil {
-		rootPool = x509.NewCertPool()
-	}
+		if response.StatusCode != 200 {
+			log.Error().Int("code", response.StatusCode).Msgf("Unexpected response %+v", string(responseBody))
+			return nil, response, newApiError(OperationGetProblems, response, responseBody)
+		}
 
-	// Append any PEM files from directories listed in SSL_CERT_DIR environment variable
-	sslCertDirEnv := os.Getenv("SSL_CERT_DIR")
-	if sslCertDirEnv != "" {
-		dirs := filepath.SplitList(sslCertDirEnv)
-		for _, dir := range dirs {
-			if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
-				_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-					if err != nil || info.IsDir() {
-						return nil
-					}
-					ext := filepath.Ext(info.Name())
-					if ext == ".crt" || ext == ".pem" || ext == ".cer" {
-						if b, err := os.ReadFile(path); err == nil {
-							rootPool.AppendCertsFromPEM(b)
-						}
-					}
-					return nil
-				})
+		var result types.GetProblemsResponse
+		if responseBody != nil {
+			err = json.Unmarshal(responseBody, &result)
+			if err != nil {
+				log.Error().Err(err).Str("body", string(responseBody)).Msgf("Failed to parse body")
+				return nil, response, err
 			}
 		}
+
+		problems = append(problems, result.Problems...)
+		if !s.hasNextPage(result.NextPageKey, page, "problems", len(problems), result.TotalCount) {
+			return problems, response, nil
+		}
+		// Dynatrace rejects any other query parameter once the nextPageKey is used
+		requestUrl = fmt.Sprintf("%s/v2/problems?nextPageKey=%s", s.ApiBaseUrl, url.QueryEscape(*result.NextPageKey))
 	}
+}
 
-	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify, RootCAs: rootPool}}
-	client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+// hasNextPage tells whether another page should be requested. Reading stops once ApiMaxPages pages were read, even if
+// Dynatrace has more results, so a very broad selector can't block the caller for too long.
+func (s *Specification) hasNextPage(nextPageKey *string, page int, resource string, count int, totalCount int) bool {
+	if nextPageKey == nil || *nextPageKey == "" {
+		return false
+	}
+	if maxPages := IntOrDefault(s.ApiMaxPages, defaultApiMaxPages); page >= maxPages {
+		log.Warn().Str("resource", resource).Int("maxPages", maxPages).Int("count", count).Int("totalCount", totalCount).
+			Msg("Reached the maximum number of pages, the result is incomplete")
+		return false
+	}
+	return true
+}
 
-	log.Debug().Str("url", url).Str("method", method).Msg("Requesting Dynatrace API")
+// do executes the request and retries it on transient errors, see shouldRetry. Each attempt is bound to the timeout
+// of the operation. The request is aborted as soon as ctx is done.
+func (s *Specification) do(ctx context.Context, operation string, url string, method string, body []byte) ([]byte, *http.Response, error) {
+	log.Debug().Str("operation", operation).Str("url", url).Str("method", method).Msg("Requesting Dynatrace API")
 	if body != nil {
 		log.Debug().Int("len", len(body)).Str("body", string(body)).Msg("Request body")
 	}
 
-	var bodyReader io.Reader
-	if body != nil {
-		bodyReader = bytes.NewReader(body)
+	deadline := time.Now().Add(DurationOrDefault(s.ApiRetryBudget, defaultApiRetryBudget))
+	for attempt := 1; ; attempt++ {
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		if err := s.waitForRateLimit(ctx, operation); err != nil {
+			return nil, nil, err
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, s.operationTimeout(operation))
+		request, err := http.NewRequestWithContext(attemptCtx, method, url, bodyReader)
+		if err != nil {
+			cancel()
+			log.Error().Err(err).Msgf("Failed to create request")
+			return nil, nil, err
+		}
+		if contentType, ok := operationContentTypes[operation]; ok {
+			request.Header.Set("Content-Type", contentType)
+		} else {
+			request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+		}
+		if err := s.authorize(attemptCtx, request, operation); err != nil {
+			cancel()
+			log.Error().Err(err).Str("operation", operation).Msgf("Failed to authorize request")
+			return nil, nil, err
+		}
+
+		started := time.Now()
+		responseBody, response, err := s.send(request)
+		cancel()
+		s.observeRequest(operation, started, response)
+		if response != nil && response.StatusCode == http.StatusUnauthorized && operationAuthModes[operation] == authOAuth {
+			s.oauthTokens().invalidate()
+		}
+		if ctx.Err() != nil {
+			return nil, response, fmt.Errorf("%s request to Dynatrace aborted: %w", operation, ctx.Err())
+		}
+		if !s.shouldRetry(method, attempt, response, err) {
+			return responseBody, response, err
+		}
+		wait := s.backoff(attempt, response)
+		if time.Now().Add(wait).After(deadline) {
+			log.Warn().Str("url", url).Str("method", method).Int("attempt", attempt).Msg("Retry budget exhausted, giving up")
+			return responseBody, response, err
+		}
+		event := log.Warn().Str("url", url).Str("method", method).Int("attempt", attempt).Dur("wait", wait)
+		if response != nil {
+			event = event.Int("code", response.StatusCode)
+		}
+		event.Err(err).Msg("Request to Dynatrace API failed, retrying")
+		select {
+		case <-ctx.Done():
+			return nil, response, fmt.Errorf("%s request to Dynatrace aborted: %w", operation, ctx.Err())
+		case <-time.After(wait):
+		}
 	}
-	request, err := http.NewRequest(method, url, bodyReader)
-	if err != nil {
-		log.Error().Err(err).Msgf("Failed to create request")
-		return nil, nil, err
+}
+
+// observeRequest records a single attempt in the request metrics.
+func (s *Specification) observeRequest(operation string, started time.Time, response *http.Response) {
+	code := "error"
+	if response != nil {
+		code = strconv.Itoa(response.StatusCode)
+	}
+	extmetrics.ApiRequests.WithLabelValues(s.tenant, operation, code).Inc()
+	extmetrics.ApiRequestDuration.WithLabelValues(s.tenant, operation).Observe(time.Since(started).Seconds())
+}
+
+func (s *Specification) operationTimeout(operation string) time.Duration {
+	if timeout, ok := s.ApiOperationTimeouts[operation]; ok && timeout > 0 {
+		return timeout
 	}
-	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	request.Header.Set("Authorization", fmt.Sprintf("Api-Token %s", s.ApiToken))
+	return DurationOrDefault(s.HttpClientTimeout, defaultHttpClientTimeout)
+}
 
-	response, err := client.Do(request)
+func (s *Specification) send(request *http.Request) ([]byte, *http.Response, error) {
+	response, err := s.httpClient().Do(request)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to execute request")
 		return nil, response, err
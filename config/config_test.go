@@ -9,7 +9,10 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/steadybit/extension-dynatrace/extmetrics"
 	"github.com/steadybit/extension-dynatrace/types"
 	"io"
 	"math/big"
@@ -19,6 +22,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -126,7 +130,7 @@ func Test_do_SendsHeadersAndBody(t *testing.T) {
 	payload := map[string]string{"k": "v"}
 	b, _ := json.Marshal(payload)
 
-	_, resp, err := s.do(srv.URL+"/v2/events/ingest", http.MethodPost, b)
+	_, resp, err := s.do(context.Background(), "test", srv.URL+"/v2/events/ingest", http.MethodPost, b)
 	if err != nil {
 		t.Fatalf("do error: %v", err)
 	}
@@ -161,7 +165,7 @@ func Test_do_Loads_SSL_CERT_DIR_ForHTTPS(t *testing.T) {
 	t.Setenv("SSL_CERT_DIR", d0+string(os.PathListSeparator)+d1)
 
 	s := Specification{ApiToken: "X", InsecureSkipVerify: false}
-	body, resp, err := s.do(srv.URL, http.MethodGet, nil)
+	body, resp, err := s.do(context.Background(), "test", srv.URL, http.MethodGet, nil)
 	if err != nil {
 		t.Fatalf("tls trust failed: %v", err)
 	}
@@ -183,7 +187,7 @@ func Test_do_FailsWithoutCA_OnHTTPS(t *testing.T) {
 	t.Setenv("SSL_CERT_DIR", "")
 
 	s := Specification{ApiToken: "X", InsecureSkipVerify: false}
-	_, _, err := s.do(srv.URL, http.MethodGet, nil)
+	_, _, err := s.do(context.Background(), "test", srv.URL, http.MethodGet, nil)
 	if err == nil {
 		t.Fatal("expected TLS verification error")
 	}
@@ -332,3 +336,873 @@ func Test_GetProblems_EscapesEntitySelector(t *testing.T) {
 		t.Fatalf("injected parameter leaked into query: b=%q", rc.Query.Get("b"))
 	}
 }
+
+/********** tests for the pooled http client **********/
+
+func Test_do_ReusesConnections(t *testing.T) {
+	var newConnections atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConnections.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	s := Specification{ApiToken: "X"}
+	for i := 0; i < 3; i++ {
+		if _, _, err := s.do(context.Background(), "test", srv.URL, http.MethodGet, nil); err != nil {
+			t.Fatalf("do error: %v", err)
+		}
+	}
+	if got := newConnections.Load(); got != 1 {
+		t.Fatalf("expected a single pooled connection, got %d", got)
+	}
+}
+
+func Test_do_ReloadsChanged_SSL_CERT_DIR(t *testing.T) {
+	certPEM, _, pair := genSelfSignedCert(t, []string{"127.0.0.1"})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+	srv := newTLSServerWithPair(t, pair, h)
+
+	d := t.TempDir()
+	t.Setenv("SSL_CERT_DIR", d)
+
+	s := Specification{ApiToken: "X", HttpCaReloadInterval: time.Nanosecond}
+	if _, _, err := s.do(context.Background(), "test", srv.URL, http.MethodGet, nil); err == nil {
+		t.Fatal("expected TLS verification error before the CA is present")
+	}
+
+	if err := os.WriteFile(filepath.Join(d, "ca.crt"), certPEM, 0600); err != nil {
+		t.Fatalf("write ca: %v", err)
+	}
+	if _, resp, err := s.do(context.Background(), "test", srv.URL, http.MethodGet, nil); err != nil {
+		t.Fatalf("CA was not reloaded: %v", err)
+	} else if resp.StatusCode != 200 {
+		t.Fatalf("status=%d", resp.StatusCode)
+	}
+}
+
+/********** tests for pagination **********/
+
+func newPagingServer(t *testing.T, path string, pages []string, rcs *[]reqCapture) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*rcs = append(*rcs, reqCapture{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query()})
+		if r.URL.Path != path {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page := 0
+		if key := r.URL.Query().Get("nextPageKey"); key != "" {
+			_, _ = fmt.Sscanf(key, "page-%d", &page)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(pages[page]))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func Test_GetProblems_FollowsNextPageKey(t *testing.T) {
+	var rcs []reqCapture
+	srv := newPagingServer(t, "/v2/problems", []string{
+		`{"totalCount":3,"nextPageKey":"page-1","problems":[{"problemId":"p1"}]}`,
+		`{"totalCount":3,"nextPageKey":"page-2","problems":[{"problemId":"p2"}]}`,
+		`{"totalCount":3,"problems":[{"problemId":"p3"}]}`,
+	}, &rcs)
+
+	sel := "type(HOST)"
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "X"}
+	problems, _, err := spec.GetProblems(context.Background(), time.Now(), &sel)
+	if err != nil {
+		t.Fatalf("GetProblems err: %v", err)
+	}
+	if len(problems) != 3 || problems[2].ProblemId != "p3" {
+		t.Fatalf("bad problems: %+v", problems)
+	}
+	if len(rcs) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(rcs))
+	}
+	// Follow-up pages must only carry the nextPageKey
+	if rcs[1].Query.Get("nextPageKey") != "page-1" || rcs[1].Query.Get("entitySelector") != "" || rcs[1].Query.Get("problemSelector") != "" {
+		t.Fatalf("bad follow-up query: %v", rcs[1].Query)
+	}
+}
+
+func Test_GetProblems_StopsAtMaxPages(t *testing.T) {
+	var rcs []reqCapture
+	srv := newPagingServer(t, "/v2/problems", []string{
+		`{"totalCount":3,"nextPageKey":"page-1","problems":[{"problemId":"p1"}]}`,
+		`{"totalCount":3,"nextPageKey":"page-2","problems":[{"problemId":"p2"}]}`,
+		`{"totalCount":3,"problems":[{"problemId":"p3"}]}`,
+	}, &rcs)
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "X", ApiMaxPages: 2}
+	problems, _, err := spec.GetProblems(context.Background(), time.Now(), nil)
+	if err != nil {
+		t.Fatalf("GetProblems err: %v", err)
+	}
+	if len(problems) != 2 || len(rcs) != 2 {
+		t.Fatalf("expected 2 problems from 2 requests, got %d from %d", len(problems), len(rcs))
+	}
+}
+
+func Test_GetEntities_FollowsNextPageKey(t *testing.T) {
+	var rcs []reqCapture
+	srv := newPagingServer(t, "/v2/entities", []string{
+		`{"totalCount":2,"nextPageKey":"page-1","entities":[{"entityId":"HOST-1"}]}`,
+		`{"totalCount":2,"entities":[{"entityId":"HOST-2"}]}`,
+	}, &rcs)
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "X"}
+	res, _, err := spec.GetEntities(context.Background(), "type(HOST)")
+	if err != nil {
+		t.Fatalf("GetEntities err: %v", err)
+	}
+	if len(res.Entities) != 2 || res.Entities[1].EntityId != "HOST-2" || res.NextPageKey != nil {
+		t.Fatalf("bad entities: %+v", res)
+	}
+	if rcs[1].Query.Get("nextPageKey") != "page-1" || rcs[1].Query.Get("entitySelector") != "" {
+		t.Fatalf("bad follow-up query: %v", rcs[1].Query)
+	}
+}
+
+/********** tests for retries **********/
+
+// newFlakyServer answers the first len(codes) requests with the given status codes and all further requests with 200.
+func newFlakyServer(t *testing.T, codes []int, header http.Header, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1))
+		if call <= len(codes) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(codes[call-1])
+			return
+		}
+		_, _ = w.Write([]byte(`{"problems":[]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func Test_do_RetriesTransientErrorsForGet(t *testing.T) {
+	var calls atomic.Int32
+	srv := newFlakyServer(t, []int{http.StatusBadGateway, http.StatusServiceUnavailable}, nil, &calls)
+
+	s := Specification{ApiToken: "X", ApiMaxRetries: 3, ApiRetryInitialBackoff: time.Millisecond}
+	_, resp, err := s.do(context.Background(), "test", srv.URL, http.MethodGet, nil)
+	if err != nil {
+		t.Fatalf("do error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("status=%d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func Test_do_RetriesConnectionReset(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "X", ApiMaxRetries: 3, ApiRetryInitialBackoff: time.Millisecond}
+	resp, err := spec.DeleteMaintenanceWindow(context.Background(), "mw-123")
+	if err != nil {
+		t.Fatalf("DeleteMW err: %v", err)
+	}
+	if resp.StatusCode != http.StatusNoContent || calls.Load() != 2 {
+		t.Fatalf("status=%d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func Test_do_GivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := newFlakyServer(t, []int{502, 502, 502, 502, 502}, nil, &calls)
+
+	s := Specification{ApiToken: "X", ApiMaxRetries: 2, ApiRetryInitialBackoff: time.Millisecond}
+	_, resp, err := s.do(context.Background(), "test", srv.URL, http.MethodGet, nil)
+	if err != nil {
+		t.Fatalf("do error: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway || calls.Load() != 3 {
+		t.Fatalf("status=%d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func Test_do_StopsWhenRetryBudgetIsExhausted(t *testing.T) {
+	var calls atomic.Int32
+	srv := newFlakyServer(t, []int{503, 503}, http.Header{"Retry-After": []string{"60"}}, &calls)
+
+	s := Specification{ApiToken: "X", ApiMaxRetries: 3, ApiRetryBudget: time.Second}
+	_, resp, _ := s.do(context.Background(), "test", srv.URL, http.MethodGet, nil)
+	if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Fatalf("status=%d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func Test_do_RetriesPostOnlyOnTooManyRequests(t *testing.T) {
+	var calls atomic.Int32
+	srv := newFlakyServer(t, []int{http.StatusTooManyRequests, http.StatusBadGateway}, http.Header{"Retry-After": []string{"0"}}, &calls)
+
+	s := Specification{ApiToken: "X", ApiMaxRetries: 3, ApiRetryInitialBackoff: time.Millisecond}
+	_, resp, _ := s.do(context.Background(), "test", srv.URL, http.MethodPost, []byte(`{}`))
+	if resp.StatusCode != http.StatusBadGateway || calls.Load() != 2 {
+		t.Fatalf("status=%d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func Test_do_RetriesPostWhenEnabled(t *testing.T) {
+	var calls atomic.Int32
+	srv := newFlakyServer(t, []int{http.StatusBadGateway}, nil, &calls)
+
+	s := Specification{ApiToken: "X", ApiMaxRetries: 3, ApiRetryInitialBackoff: time.Millisecond, ApiRetryPost: true}
+	_, resp, _ := s.do(context.Background(), "test", srv.URL, http.MethodPost, []byte(`{}`))
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("status=%d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("7"); !ok || d != 7*time.Second {
+		t.Fatalf("seconds: %v %v", d, ok)
+	}
+	if d, ok := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); !ok || d < 59*time.Minute {
+		t.Fatalf("date: %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Fatal("expected invalid value to be ignored")
+	}
+}
+
+/********** tests for context handling **********/
+
+func Test_GetProblems_AbortsWhenContextIsCanceled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "X", ApiMaxRetries: 3}
+	start := time.Now()
+	_, _, err := spec.GetProblems(ctx, time.Now(), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("request was not aborted")
+	}
+}
+
+func Test_do_UsesOperationTimeout(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "X", ApiOperationTimeouts: map[string]time.Duration{OperationGetEntities: 50 * time.Millisecond}}
+	_, _, err := spec.GetEntities(context.Background(), "type(HOST)")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if calls.Load() > 1 {
+		t.Fatalf("expected no retries, got %d calls", calls.Load())
+	}
+}
+
+func Test_ToError_ReportsCancellation(t *testing.T) {
+	err := ToError("Failed to get problems from Dynatrace.", fmt.Errorf("getProblems request to Dynatrace aborted: %w", context.Canceled))
+	if err.Title != "Failed to get problems from Dynatrace. The request to Dynatrace was canceled." {
+		t.Fatalf("title=%s", err.Title)
+	}
+	err = ToError("Failed to get problems from Dynatrace.", context.DeadlineExceeded)
+	if err.Title != "Failed to get problems from Dynatrace. The request to Dynatrace timed out." {
+		t.Fatalf("title=%s", err.Title)
+	}
+}
+
+/********** tests for the token scope validation **********/
+
+func Test_validateToken_DetectsMissingScopes(t *testing.T) {
+	rc := &reqCapture{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc.Path = r.URL.Path
+		rc.Body, _ = io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(`{"id":"dt0c01.ABC","name":"steadybit","enabled":true,"scopes":["events.ingest","entities.read"]}`))
+	}))
+	defer srv.Close()
+	t.Cleanup(func() { tokenScopes = nil })
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "dt0c01.ABC.SECRET"}
+	if !spec.validateToken(context.Background()) {
+		t.Fatal("expected token to be valid")
+	}
+	if rc.Path != "/v2/apiTokens/lookup" || !bytes.Contains(rc.Body, []byte(`"token":"dt0c01.ABC.SECRET"`)) {
+		t.Fatalf("bad lookup request: %s %s", rc.Path, string(rc.Body))
+	}
+	if missing := MissingScopes(ScopeEventsIngest, ScopeEntitiesRead); len(missing) != 0 {
+		t.Fatalf("unexpected missing scopes: %v", missing)
+	}
+	if missing := MissingScopes(ScopeProblemsRead, ScopeSettingsWrite); len(missing) != 2 {
+		t.Fatalf("expected two missing scopes, got %v", missing)
+	}
+	if HasScopes("The action 'Problem Check'", ScopeProblemsRead) {
+		t.Fatal("expected the problem check to be disabled")
+	}
+}
+
+func Test_validateToken_RejectedToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "invalid"}
+	if spec.validateToken(context.Background()) {
+		t.Fatal("expected token to be rejected")
+	}
+}
+
+func Test_validateToken_AssumesAllScopesWhenLookupFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "X"}
+	if !spec.validateToken(context.Background()) {
+		t.Fatal("expected token to be accepted")
+	}
+	if missing := MissingScopes(ScopeProblemsRead); len(missing) != 0 {
+		t.Fatalf("unexpected missing scopes: %v", missing)
+	}
+}
+
+/********** tests for OAuth **********/
+
+func newOAuthServer(t *testing.T, expiresIn int, tokenCalls *atomic.Int32, rc *reqCapture) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sso/oauth2/token":
+			_ = r.ParseForm()
+			if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("client_id") != "client" ||
+				r.Form.Get("client_secret") != "secret" || r.Form.Get("resource") != "urn:dtaccount:acc" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			n := tokenCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, expiresIn)
+		default:
+			rc.Path = r.URL.Path
+			rc.Header = r.Header.Clone()
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+}
+
+func newOAuthSpec(srvURL string) *Specification {
+	return &Specification{
+		ApiBaseUrl:        srvURL,
+		ApiToken:          "api-token",
+		OAuthClientId:     "client",
+		OAuthClientSecret: "secret",
+		OAuthAccountUrn:   "urn:dtaccount:acc",
+		OAuthTokenUrl:     srvURL + "/sso/oauth2/token",
+	}
+}
+
+func withOAuthOperation(t *testing.T, operation string) {
+	operationAuthModes[operation] = authOAuth
+	t.Cleanup(func() { delete(operationAuthModes, operation) })
+}
+
+func Test_do_UsesAuthModeOfOperation(t *testing.T) {
+	var tokenCalls atomic.Int32
+	rc := &reqCapture{}
+	srv := newOAuthServer(t, 300, &tokenCalls, rc)
+	defer srv.Close()
+	withOAuthOperation(t, "platform")
+	s := newOAuthSpec(srv.URL)
+
+	if _, _, err := s.do(context.Background(), "classic", srv.URL+"/api", http.MethodGet, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got := rc.Header.Get("Authorization"); got != "Api-Token api-token" {
+		t.Fatalf("classic auth header=%q", got)
+	}
+
+	for range 2 {
+		if _, _, err := s.do(context.Background(), "platform", srv.URL+"/platform", http.MethodGet, nil); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if got := rc.Header.Get("Authorization"); got != "Bearer token-1" {
+			t.Fatalf("platform auth header=%q", got)
+		}
+	}
+	if tokenCalls.Load() != 1 {
+		t.Fatalf("expected the token to be cached, fetched %d times", tokenCalls.Load())
+	}
+}
+
+func Test_oauthTokenSource_RefreshesBeforeExpiry(t *testing.T) {
+	var tokenCalls atomic.Int32
+	srv := newOAuthServer(t, 30, &tokenCalls, &reqCapture{})
+	defer srv.Close()
+	s := newOAuthSpec(srv.URL)
+
+	// tokens expiring within the refresh margin are never reused
+	for i := 1; i <= 2; i++ {
+		token, err := s.oauthTokens().get(context.Background())
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if token != fmt.Sprintf("token-%d", i) {
+			t.Fatalf("token=%s", token)
+		}
+	}
+}
+
+func Test_do_InvalidatesRejectedOAuthToken(t *testing.T) {
+	var tokenCalls atomic.Int32
+	var rejected atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sso/oauth2/token" {
+			_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":300}`, tokenCalls.Add(1))
+			return
+		}
+		if rejected.CompareAndSwap(false, true) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	withOAuthOperation(t, "platform")
+	s := newOAuthSpec(srv.URL)
+
+	_, resp, _ := s.do(context.Background(), "platform", srv.URL+"/platform", http.MethodGet, nil)
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", resp)
+	}
+	_, resp, err := s.do(context.Background(), "platform", srv.URL+"/platform", http.MethodGet, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("err=%v resp=%v", err, resp)
+	}
+	if tokenCalls.Load() != 2 {
+		t.Fatalf("expected a new token after the rejection, fetched %d times", tokenCalls.Load())
+	}
+}
+
+func Test_VerifyQuery_UsesOAuthToken(t *testing.T) {
+	var tokenCalls atomic.Int32
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sso/oauth2/token" {
+			_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":300}`, tokenCalls.Add(1))
+			return
+		}
+		if r.URL.Path != "/platform/storage/query/v1/query:verify" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(`{"valid":true,"notifications":[]}`))
+	}))
+	defer srv.Close()
+	s := newOAuthSpec(srv.URL)
+	s.PlatformBaseUrl = srv.URL + "/platform"
+
+	result, _, err := s.VerifyQuery(context.Background(), validationQuery)
+
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !result.Valid {
+		t.Fatal("expected the query to be valid")
+	}
+	if got := header.Get("Authorization"); got != "Bearer token-1" {
+		t.Fatalf("auth header=%q", got)
+	}
+	if string(body) != `{"query":"fetch events | limit 1"}` {
+		t.Fatalf("body=%s", body)
+	}
+}
+
+func Test_oauthTokenSource_RequiresCredentials(t *testing.T) {
+	s := &Specification{OAuthClientId: "client"}
+	if _, err := s.oauthTokens().get(context.Background()); err == nil {
+		t.Fatal("expected an error for incomplete credentials")
+	}
+}
+
+/********** tests for tenants **********/
+
+func withTenants(t *testing.T, value string) {
+	t.Helper()
+	previous := Config
+	t.Cleanup(func() {
+		Config = previous
+		_ = initTenants()
+	})
+	Config = Specification{ApiBaseUrl: "https://default", UiBaseUrl: "https://default-ui", ApiToken: "default-token", DefaultTenantName: "default"}
+	if err := Config.Tenants.Decode(value); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if err := initTenants(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+}
+
+func Test_ForEvent_RoutesByTeamAndEnvironment(t *testing.T) {
+	withTenants(t, `[
+		{"name":"staging","apiBaseUrl":"https://staging","apiToken":"staging-token","environments":["Staging"]},
+		{"name":"payments","apiBaseUrl":"https://payments","apiToken":"payments-token","teams":["PAY"],"uiBaseUrl":"https://payments-ui"}
+	]`)
+
+	if got := ForEvent("Staging", "").TenantName(); got != "staging" {
+		t.Fatalf("environment routing: %s", got)
+	}
+	if got := ForEvent("Staging", "PAY").TenantName(); got != "payments" {
+		t.Fatalf("teams take precedence: %s", got)
+	}
+	if got := ForEvent("Production", "OPS").TenantName(); got != "default" {
+		t.Fatalf("fallback: %s", got)
+	}
+
+	staging, err := ForTenant("staging")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if staging.ApiBaseUrl != "https://staging" || staging.ApiToken != "staging-token" || staging.UiBaseUrl != "https://default-ui" {
+		t.Fatalf("unexpected staging spec: %+v", staging)
+	}
+	if payments, _ := ForTenant("payments"); payments.UiBaseUrl != "https://payments-ui" {
+		t.Fatalf("ui base url not overridden: %s", payments.UiBaseUrl)
+	}
+	if spec, _ := ForTenant(""); spec != &Config {
+		t.Fatal("expected the default tenant for an empty name")
+	}
+	if _, err := ForTenant("unknown"); err == nil {
+		t.Fatal("expected an error for an unknown tenant")
+	}
+	if names := TenantNames(); len(names) != 3 || names[0] != "default" {
+		t.Fatalf("names=%v", names)
+	}
+}
+
+func Test_initTenants_RejectsInvalidTenants(t *testing.T) {
+	withTenants(t, `[]`)
+	Config.Tenants = TenantList{
+		{Name: "default", ApiBaseUrl: "https://x", ApiToken: "x"},
+		{Name: "noToken", ApiBaseUrl: "https://x"},
+		{ApiBaseUrl: "https://x", ApiToken: "x"},
+	}
+	err := initTenants()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, msg := range []string{"duplicate tenant 'default'", "tenant 'noToken' needs", "tenant without name"} {
+		if !bytes.Contains([]byte(err.Error()), []byte(msg)) {
+			t.Fatalf("missing %q in %v", msg, err)
+		}
+	}
+}
+
+func Test_TenantParameter_OnlyWithSeveralTenants(t *testing.T) {
+	withTenants(t, `[]`)
+	if TenantParameter(1) != nil {
+		t.Fatal("expected no parameter for a single tenant")
+	}
+	withTenants(t, `[{"name":"staging","apiBaseUrl":"https://staging","apiToken":"x"}]`)
+	parameter := TenantParameter(1)
+	if parameter == nil || *parameter.DefaultValue != "default" || len(*parameter.Options) != 2 {
+		t.Fatalf("unexpected parameter: %+v", parameter)
+	}
+}
+
+/********** tests for API errors **********/
+
+func Test_GetProblems_ReturnsApiErrorWithConstraintViolations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"code":400,"message":"Constraints violated.","constraintViolations":[{"path":"entitySelector","message":"Unknown entity type FOO","parameterLocation":"QUERY","location":null}]}}`))
+	}))
+	defer srv.Close()
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "X"}
+	_, _, err := spec.GetProblems(context.Background(), time.Now(), new("type(FOO)"))
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected ApiError, got %v", err)
+	}
+	if apiErr.StatusCode != 400 || apiErr.Message != "Constraints violated." || len(apiErr.ConstraintViolations) != 1 || apiErr.Retryable() {
+		t.Fatalf("unexpected error: %+v", apiErr)
+	}
+	title := ToError("Failed to get problems from Dynatrace.", err).Title
+	if title != "Failed to get problems from Dynatrace. Dynatrace responded with status code 400: Constraints violated. entitySelector: Unknown entity type FOO" {
+		t.Fatalf("title=%s", title)
+	}
+}
+
+func Test_CreateMaintenanceWindow_ReturnsSettingsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`[{"code":400,"error":{"code":400,"message":"Validation failed","constraintViolations":[{"path":"schedule/onceRecurrence/endTime","message":"End time must be after start time"}]}}]`))
+	}))
+	defer srv.Close()
+
+	spec := Specification{ApiBaseUrl: srv.URL, ApiToken: "X"}
+	_, _, err := spec.CreateMaintenanceWindow(context.Background(), types.CreateMaintenanceWindowRequest{})
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected ApiError, got %v", err)
+	}
+	if apiErr.Summary() != "Validation failed schedule/onceRecurrence/endTime: End time must be after start time" {
+		t.Fatalf("summary=%s", apiErr.Summary())
+	}
+}
+
+func Test_ApiError_KeepsBodyWithoutEnvelope(t *testing.T) {
+	apiErr := newApiError("test", &http.Response{StatusCode: http.StatusServiceUnavailable}, []byte("<html>maintenance</html>"))
+	if apiErr.Summary() != "<html>maintenance</html>" || !apiErr.Retryable() || !IsRetryable(fmt.Errorf("wrapped: %w", apiErr)) {
+		t.Fatalf("unexpected error: %+v", apiErr)
+	}
+	if IsRetryable(errors.New("other")) {
+		t.Fatal("expected other errors to be permanent")
+	}
+}
+
+/********** tests for rate limiting **********/
+
+func Test_do_WaitsForRateLimit(t *testing.T) {
+	srv := newMockHTTPServer(t, nil)
+	defer srv.Close()
+
+	s := Specification{ApiBaseUrl: srv.URL, ApiToken: "X", ApiRateLimits: map[string]float64{FamilyProblems: 5}, ApiRateLimitBurst: 1, tenant: "ratelimit-wait"}
+	waited := extmetrics.ApiThrottled.WithLabelValues("ratelimit-wait", FamilyProblems, "waited")
+	waitedSeconds := extmetrics.ApiThrottledSeconds.WithLabelValues("ratelimit-wait", FamilyProblems)
+	start := time.Now()
+	for range 3 {
+		if _, _, err := s.GetProblems(context.Background(), time.Now(), nil); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Fatalf("expected the requests to be throttled, took %s", elapsed)
+	}
+	if testutil.ToFloat64(waited) != 2 || testutil.ToFloat64(waitedSeconds) == 0 {
+		t.Fatalf("waited=%v seconds=%v", testutil.ToFloat64(waited), testutil.ToFloat64(waitedSeconds))
+	}
+	if _, _, err := s.PostEvent(context.Background(), types.EventIngest{Title: "test"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if testutil.ToFloat64(extmetrics.ApiThrottled.WithLabelValues("ratelimit-wait", FamilyEvents, "waited")) != 0 {
+		t.Fatal("expected separate budgets per family")
+	}
+}
+
+func Test_do_RejectsWhenRateLimitWaitExceedsDeadline(t *testing.T) {
+	srv := newMockHTTPServer(t, nil)
+	defer srv.Close()
+
+	s := Specification{ApiBaseUrl: srv.URL, ApiToken: "X", ApiRateLimits: map[string]float64{FamilySettings: 0.1}, ApiRateLimitBurst: 1, ApiRateLimitMaxWait: 100 * time.Millisecond, tenant: "ratelimit-reject"}
+	if _, err := s.DeleteMaintenanceWindow(context.Background(), "mw-123"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	_, err := s.DeleteMaintenanceWindow(context.Background(), "mw-123")
+	if !errors.Is(err, ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+	if testutil.ToFloat64(extmetrics.ApiThrottled.WithLabelValues("ratelimit-reject", FamilySettings, "rejected")) != 1 {
+		t.Fatal("expected one rejected request")
+	}
+}
+
+func Test_do_RateLimitCanBeDisabled(t *testing.T) {
+	srv := newMockHTTPServer(t, nil)
+	defer srv.Close()
+
+	s := Specification{ApiBaseUrl: srv.URL, ApiToken: "X", ApiRateLimits: map[string]float64{FamilyProblems: 0}, ApiRateLimitBurst: 1, tenant: "ratelimit-disabled"}
+	for range 20 {
+		if _, _, err := s.GetProblems(context.Background(), time.Now(), nil); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if testutil.ToFloat64(extmetrics.ApiThrottled.WithLabelValues("ratelimit-disabled", FamilyProblems, "waited")) != 0 {
+		t.Fatal("expected no throttling")
+	}
+}
+
+/********** tests for metrics **********/
+
+func Test_do_RecordsRequestMetrics(t *testing.T) {
+	srv := newMockHTTPServer(t, nil)
+	defer srv.Close()
+
+	s := Specification{ApiBaseUrl: srv.URL, ApiToken: "X", tenant: "metrics"}
+	problems := extmetrics.ApiRequests.WithLabelValues("metrics", OperationGetProblems, "200")
+	deletes := extmetrics.ApiRequests.WithLabelValues("metrics", OperationDeleteMaintenanceWindow, "400")
+	problemsBefore, deletesBefore := testutil.ToFloat64(problems), testutil.ToFloat64(deletes)
+	if _, _, err := s.GetProblems(context.Background(), time.Now(), nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	_, _ = s.DeleteMaintenanceWindow(context.Background(), "unknown")
+
+	if got := testutil.ToFloat64(problems) - problemsBefore; got != 1 {
+		t.Fatalf("getProblems requests=%v", got)
+	}
+	if got := testutil.ToFloat64(deletes) - deletesBefore; got != 1 {
+		t.Fatalf("deleteMaintenanceWindow requests=%v", got)
+	}
+	if got := testutil.CollectAndCount(extmetrics.ApiRequestDuration, "steadybit_extension_dynatrace_api_request_duration_seconds"); got < 2 {
+		t.Fatalf("duration series=%d", got)
+	}
+}
+
+/********** tests for event templates **********/
+
+func TestEventTemplates_Decode(t *testing.T) {
+	var templates EventTemplates
+	err := templates.Decode(`{"experiment.started":{"title":"Experiment {{.Name}}","properties":{"ticket":"{{.Ticket}}"}}}`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	data := struct{ Name, Ticket string }{Name: "checkout", Ticket: "OPS-42"}
+	title, ok, err := templates["experiment.started"].RenderTitle(data)
+	if err != nil || !ok || title != "Experiment checkout" {
+		t.Fatalf("title=%q ok=%v err=%v", title, ok, err)
+	}
+	properties, err := templates["experiment.started"].RenderProperties(data)
+	if err != nil || properties["ticket"] != "OPS-42" {
+		t.Fatalf("properties=%v err=%v", properties, err)
+	}
+}
+
+func TestEventTemplates_DecodeRejectsInvalidTemplates(t *testing.T) {
+	var templates EventTemplates
+	if err := templates.Decode(`{"experiment.started":{"title":"{{.Name"}}`); err == nil {
+		t.Fatalf("expected error for invalid title")
+	}
+	if err := templates.Decode(`{"experiment.started":{"properties":{"ticket":"{{end}}"}}}`); err == nil {
+		t.Fatalf("expected error for invalid property")
+	}
+}
+
+/********** tests for event filters **********/
+
+func TestEventFilters_Decode(t *testing.T) {
+	var filters EventFilters
+	if err := filters.Decode(`[{"environments":["Development"]},{"experiments":["DEV-*"],"principalTypes":["batch"]}]`); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(filters) != 2 || filters[1].Experiments[0] != "DEV-*" {
+		t.Fatalf("filters=%+v", filters)
+	}
+	if err := filters.Decode(`[{"actions":["com.steadybit.[a"]}]`); err == nil {
+		t.Fatalf("expected error for invalid pattern")
+	}
+}
+
+func TestSpecification_ForwardsEvent(t *testing.T) {
+	spec := Specification{
+		EventAllow: EventFilters{{Environments: []string{"Production"}}, {Teams: []string{"OPS"}}},
+		EventDeny:  EventFilters{{PrincipalTypes: []string{"batch"}}, {Experiments: []string{"PROD-9*"}, Actions: []string{"com.steadybit.extension_container.*"}}},
+	}
+	tests := []struct {
+		scope EventScope
+		want  bool
+	}{
+		{EventScope{Environment: "Production", Experiment: "PROD-1", PrincipalType: "user"}, true},
+		{EventScope{Environment: "Development", Team: "OPS", PrincipalType: "user"}, true},
+		{EventScope{Environment: "Development", Team: "DEV", PrincipalType: "user"}, false},
+		{EventScope{Environment: "Production", PrincipalType: "Batch"}, false},
+		{EventScope{Environment: "Production", Experiment: "PROD-91", Action: "com.steadybit.extension_container.stop"}, false},
+		{EventScope{Environment: "Production", Experiment: "PROD-91", Action: "com.steadybit.extension_host.stress-cpu"}, true},
+		{EventScope{Environment: "Production", Experiment: "PROD-91"}, true},
+	}
+	for _, tt := range tests {
+		if got := spec.ForwardsEvent(tt.scope); got != tt.want {
+			t.Fatalf("ForwardsEvent(%+v) = %v, want %v", tt.scope, got, tt.want)
+		}
+	}
+	if !(&Specification{}).ForwardsEvent(EventScope{}) {
+		t.Fatalf("expected events to be forwarded without filters")
+	}
+}
+
+func TestSpecification_ForwardsExecution(t *testing.T) {
+	spec := Specification{
+		EventAllow: EventFilters{{Environments: []string{"Production"}, Actions: []string{"com.steadybit.extension_host.*"}}},
+		EventDeny:  EventFilters{{PrincipalTypes: []string{"batch"}}, {Experiments: []string{"PROD-9*"}, Actions: []string{"com.steadybit.extension_container.*"}}},
+	}
+	tests := []struct {
+		scope EventScope
+		want  bool
+	}{
+		{EventScope{Environment: "Production", Experiment: "PROD-1", PrincipalType: "user"}, true},
+		{EventScope{Environment: "Production", Experiment: "PROD-91", PrincipalType: "user"}, true},
+		{EventScope{Environment: "Development", Experiment: "PROD-1", PrincipalType: "user"}, false},
+		{EventScope{Environment: "Production", Experiment: "PROD-1", PrincipalType: "batch"}, false},
+	}
+	for _, tt := range tests {
+		if got := spec.ForwardsExecution(tt.scope); got != tt.want {
+			t.Fatalf("ForwardsExecution(%+v) = %v, want %v", tt.scope, got, tt.want)
+		}
+	}
+}
+
+/********** tests for metric ingest **********/
+
+func Test_IngestMetrics_SendsLineProtocol(t *testing.T) {
+	var contentType, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"linesOk":1,"linesInvalid":1,"error":{"code":400,"message":"1 invalid line"}}`))
+	}))
+	defer srv.Close()
+
+	s := Specification{ApiBaseUrl: srv.URL, ApiToken: "X"}
+	result, _, err := s.IngestMetrics(context.Background(), []string{"a gauge,1", "b gauge,x"})
+	if err == nil {
+		t.Fatal("expected error for rejected lines")
+	}
+	if contentType != "text/plain; charset=utf-8" || body != "a gauge,1\nb gauge,x" {
+		t.Fatalf("contentType=%q body=%q", contentType, body)
+	}
+	if result == nil || result.LinesInvalid != 1 || result.Error == nil || result.Error.Message != "1 invalid line" {
+		t.Fatalf("result=%+v", result)
+	}
+}
@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	extension_kit "github.com/steadybit/extension-kit"
+)
+
+// ToError converts the error of a Dynatrace API call into an ExtensionError. Canceled and timed out requests are
+// reported as such instead of showing the low-level error only. For errors returned by the Dynatrace API, the title
+// contains the message and constraint violations sent by Dynatrace.
+func ToError(title string, err error) extension_kit.ExtensionError {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return extension_kit.ToError(fmt.Sprintf("%s Dynatrace responded with status code %d: %s", title, apiErr.StatusCode, apiErr.Summary()), err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return extension_kit.ToError(fmt.Sprintf("%s The request to Dynatrace was canceled.", title), err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return extension_kit.ToError(fmt.Sprintf("%s The request to Dynatrace timed out.", title), err)
+	}
+	return extension_kit.ToError(title, err)
+}
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// EventFilter matches the events of executions. All conditions that are set must match. Experiments and actions are
+// glob patterns, like 'DEV-*' or 'com.steadybit.extension_container.*'. Rules with actions only match the events of
+// steps and targets.
+type EventFilter struct {
+	Environments []string `json:"environments,omitempty"`
+	Teams        []string `json:"teams,omitempty"`
+	Experiments  []string `json:"experiments,omitempty"`
+	// PrincipalTypes who started the execution, like 'user', 'access_token' or 'batch'
+	PrincipalTypes []string `json:"principalTypes,omitempty"`
+	Actions        []string `json:"actions,omitempty"`
+}
+
+// EventFilters is parsed from a JSON array, like '[{"environments":["Development"]},{"principalTypes":["batch"]}]'
+type EventFilters []EventFilter
+
+// EventScope describes the execution an event belongs to.
+type EventScope struct {
+	Environment   string
+	Team          string
+	Experiment    string
+	PrincipalType string
+	// Action is empty for the events of experiments
+	Action string
+}
+
+// Decode implements envconfig.Decoder
+func (f *EventFilters) Decode(value string) error {
+	if err := json.Unmarshal([]byte(value), f); err != nil {
+		return err
+	}
+	var errs []error
+	for i, filter := range *f {
+		for _, pattern := range slices.Concat(filter.Experiments, filter.Actions) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("filter %d: invalid pattern '%s'", i, pattern))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ForwardsEvent reports whether events of the scope are sent to Dynatrace. With allow rules, the scope must match one
+// of them. It must match none of the deny rules.
+func (s *Specification) ForwardsEvent(scope EventScope) bool {
+	if len(s.EventAllow) > 0 && !s.EventAllow.matches(scope) {
+		return false
+	}
+	return !s.EventDeny.matches(scope)
+}
+
+// ForwardsExecution reports whether events of the scope may be sent to Dynatrace before their action is known. The
+// allow rules are matched without their actions, and only deny rules without actions apply. The action is checked
+// with ForwardsEvent once it is known.
+func (s *Specification) ForwardsExecution(scope EventScope) bool {
+	if len(s.EventAllow) > 0 && !slices.ContainsFunc(s.EventAllow, func(filter EventFilter) bool { return filter.matchesExecution(scope) }) {
+		return false
+	}
+	return !slices.ContainsFunc(s.EventDeny, func(filter EventFilter) bool { return len(filter.Actions) == 0 && filter.matchesExecution(scope) })
+}
+
+func (f EventFilters) matches(scope EventScope) bool {
+	return slices.ContainsFunc(f, func(filter EventFilter) bool { return filter.matches(scope) })
+}
+
+func (f *EventFilter) matches(scope EventScope) bool {
+	return f.matchesExecution(scope) && (len(f.Actions) == 0 || (scope.Action != "" && matchesPattern(f.Actions, scope.Action)))
+}
+
+// matchesExecution reports whether the conditions of the filter on the execution match, all but the actions.
+func (f *EventFilter) matchesExecution(scope EventScope) bool {
+	return (len(f.Environments) == 0 || slices.Contains(f.Environments, scope.Environment)) &&
+		(len(f.Teams) == 0 || slices.Contains(f.Teams, scope.Team)) &&
+		(len(f.PrincipalTypes) == 0 || slices.ContainsFunc(f.PrincipalTypes, func(t string) bool { return strings.EqualFold(t, scope.PrincipalType) })) &&
+		matchesPattern(f.Experiments, scope.Experiment)
+}
+
+// matchesPattern reports whether the value matches one of the patterns, or there are none.
+func matchesPattern(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, value)
+		return matched
+	})
+}
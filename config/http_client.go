@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultHttpClientTimeout       = 30 * time.Second
+	defaultHttpMaxIdleConns        = 100
+	defaultHttpMaxIdleConnsPerHost = 10
+	defaultHttpIdleConnTimeout     = 90 * time.Second
+	defaultHttpTlsHandshakeTimeout = 10 * time.Second
+	defaultHttpCaReloadInterval    = time.Minute
+)
+
+var clientInitMutex sync.Mutex
+
+// pooledClient is the long-lived http client used for all Dynatrace API calls. Connections are kept alive and reused.
+// The extra CA certificates from SSL_CERT_DIR are checked for changes at most once per reload interval. When they
+// changed, a new transport is created and the idle connections of the previous one are closed.
+type pooledClient struct {
+	mutex       sync.Mutex
+	spec        *Specification
+	client      *http.Client
+	fingerprint string
+	lastCheck   time.Time
+}
+
+// InitHttpClient creates the pooled http client. It is called once at startup; the client is created lazily on the
+// first request otherwise.
+func (s *Specification) InitHttpClient() {
+	s.pooledClient()
+}
+
+func (s *Specification) pooledClient() *pooledClient {
+	clientInitMutex.Lock()
+	defer clientInitMutex.Unlock()
+	if s.client == nil {
+		s.client = &pooledClient{spec: s}
+		s.client.reload(time.Now())
+	}
+	return s.client
+}
+
+func (s *Specification) httpClient() *http.Client {
+	return s.pooledClient().get()
+}
+
+func (p *pooledClient) get() *http.Client {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(p.lastCheck) >= DurationOrDefault(p.spec.HttpCaReloadInterval, defaultHttpCaReloadInterval) {
+		p.lastCheck = now
+		if fingerprint := caCertFingerprint(); fingerprint != p.fingerprint {
+			log.Info().Msg("CA certificates changed on disk, recreating http client")
+			p.reload(now)
+		}
+	}
+	return p.client
+}
+
+func (p *pooledClient) reload(now time.Time) {
+	previous := p.client
+	p.fingerprint = caCertFingerprint()
+	p.lastCheck = now
+	p.client = newHttpClient(p.spec)
+	if previous != nil {
+		previous.CloseIdleConnections()
+	}
+}
+
+func newHttpClient(s *Specification) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        IntOrDefault(s.HttpMaxIdleConns, defaultHttpMaxIdleConns),
+		MaxIdleConnsPerHost: IntOrDefault(s.HttpMaxIdleConnsPerHost, defaultHttpMaxIdleConnsPerHost),
+		IdleConnTimeout:     DurationOrDefault(s.HttpIdleConnTimeout, defaultHttpIdleConnTimeout),
+		TLSHandshakeTimeout: DurationOrDefault(s.HttpTlsHandshakeTimeout, defaultHttpTlsHandshakeTimeout),
+		TLSClientConfig:     &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify, RootCAs: loadCertPool()},
+	}
+	// Timeouts are applied per request through the request context, see Specification.operationTimeout
+	return &http.Client{Transport: transport}
+}
+
+// loadCertPool returns the system cert pool extended by all PEM files from the directories listed in SSL_CERT_DIR.
+func loadCertPool() *x509.CertPool {
+	rootPool, errPool := x509.SystemCertPool()
+	if rootPool == nil || errPool != nil {
+		rootPool = x509.NewCertPool()
+	}
+	for _, path := range caCertFiles() {
+		if b, err := os.ReadFile(path); err == nil {
+			rootPool.AppendCertsFromPEM(b)
+		}
+	}
+	return rootPool
+}
+
+// caCertFingerprint identifies the current state of the extra CA certificates by path, size and modification time.
+func caCertFingerprint() string {
+	var sb strings.Builder
+	for _, path := range caCertFiles() {
+		if fi, err := os.Stat(path); err == nil {
+			sb.WriteString(fmt.Sprintf("%s|%d|%d;", path, fi.Size(), fi.ModTime().UnixNano()))
+		}
+	}
+	return sb.String()
+}
+
+func caCertFiles() []string {
+	var files []string
+	sslCertDirEnv := os.Getenv("SSL_CERT_DIR")
+	if sslCertDirEnv == "" {
+		return files
+	}
+	for _, dir := range filepath.SplitList(sslCertDirEnv) {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return nil
+				}
+				ext := filepath.Ext(info.Name())
+				if ext == ".crt" || ext == ".pem" || ext == ".cer" {
+					files = append(files, path)
+				}
+				return nil
+			})
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// DurationOrDefault returns the value, or the default if it isn't positive.
+func DurationOrDefault(value time.Duration, defaultValue time.Duration) time.Duration {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// IntOrDefault returns the value, or the default if it isn't positive.
+func IntOrDefault(value int, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
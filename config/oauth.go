@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// tokenRefreshMargin is how long before its expiry a cached OAuth token is replaced by a new one
+const tokenRefreshMargin = time.Minute
+
+type authMode int
+
+const (
+	// authApiToken sends the API token, used by the classic environment API v2
+	authApiToken authMode = iota
+	// authOAuth sends an OAuth2 bearer token from the Dynatrace SSO, used by the Dynatrace platform APIs
+	authOAuth
+)
+
+// operationAuthModes holds the operations that don't use the API token
+var operationAuthModes = map[string]authMode{
+	OperationIngestBizEvent: authOAuth,
+	OperationVerifyQuery:    authOAuth,
+}
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// oauthTokenSource fetches OAuth2 tokens with the client credentials grant and caches them until shortly before
+// they expire.
+type oauthTokenSource struct {
+	mutex  sync.Mutex
+	spec   *Specification
+	token  string
+	expiry time.Time
+}
+
+// HasOAuthCredentials tells whether OAuth2 client credentials are configured.
+func (s *Specification) HasOAuthCredentials() bool {
+	return s.OAuthClientId != "" && s.OAuthClientSecret != "" && s.OAuthAccountUrn != ""
+}
+
+func (s *Specification) oauthTokens() *oauthTokenSource {
+	clientInitMutex.Lock()
+	defer clientInitMutex.Unlock()
+	if s.oauth == nil {
+		s.oauth = &oauthTokenSource{spec: s}
+	}
+	return s.oauth
+}
+
+// authorize sets the Authorization header matching the auth mode of the operation.
+func (s *Specification) authorize(ctx context.Context, request *http.Request, operation string) error {
+	if operationAuthModes[operation] != authOAuth {
+		request.Header.Set("Authorization", fmt.Sprintf("Api-Token %s", s.ApiToken))
+		return nil
+	}
+	token, err := s.oauthTokens().get(ctx)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return nil
+}
+
+func (o *oauthTokenSource) get(ctx context.Context) (string, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.token != "" && time.Now().Add(tokenRefreshMargin).Before(o.expiry) {
+		return o.token, nil
+	}
+	token, err := o.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	o.token = token.AccessToken
+	o.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	log.Debug().Time("expiry", o.expiry).Msg("Fetched OAuth token from Dynatrace SSO")
+	return o.token, nil
+}
+
+// invalidate drops the cached token, e.g. after Dynatrace rejected it.
+func (o *oauthTokenSource) invalidate() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.token = ""
+}
+
+func (o *oauthTokenSource) fetch(ctx context.Context) (*oauthTokenResponse, error) {
+	if !o.spec.HasOAuthCredentials() {
+		return nil, errors.New("OAuth client credentials are not configured")
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {o.spec.OAuthClientId},
+		"client_secret": {o.spec.OAuthClientSecret},
+		"resource":      {o.spec.OAuthAccountUrn},
+	}
+	if o.spec.OAuthScopes != "" {
+		form.Set("scope", o.spec.OAuthScopes)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DurationOrDefault(o.spec.HttpClientTimeout, defaultHttpClientTimeout))
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, o.spec.OAuthTokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := o.spec.httpClient().Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OAuth token: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OAuth token response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OAuth token, unexpected response code %d: %s", response.StatusCode, string(body))
+	}
+
+	var token oauthTokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("failed to parse OAuth token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("OAuth token response contains no access token")
+	}
+	return &token, nil
+}
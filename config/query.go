@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-dynatrace/types"
+)
+
+// validationQuery is verified at startup to check the OAuth client against the Grail query API
+const validationQuery = "fetch events | limit 1"
+
+// VerifyQuery checks a DQL query with the Grail query API of the Dynatrace platform, without running it. Like all
+// platform APIs, it requires an OAuth token instead of the API token.
+func (s *Specification) VerifyQuery(ctx context.Context, query string) (*types.QueryVerification, *http.Response, error) {
+	b, err := json.Marshal(types.QueryRequest{Query: query})
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to marshal request")
+		return nil, nil, err
+	}
+
+	responseBody, response, err := s.do(ctx, OperationVerifyQuery, fmt.Sprintf("%s/storage/query/v1/query:verify", s.PlatformBaseUrl), "POST", b)
+	if err != nil {
+		return nil, response, err
+	}
+
+	if response.StatusCode != 200 {
+		return nil, response, newApiError(OperationVerifyQuery, response, responseBody)
+	}
+
+	var result types.QueryVerification
+	err = json.Unmarshal(responseBody, &result)
+	if err != nil {
+		log.Error().Err(err).Str("body", string(responseBody)).Msgf("Failed to parse response body")
+		return nil, response, err
+	}
+	return &result, response, nil
+}
+
+// validateOAuth verifies a query with the Grail query API, which checks the platform base url and that the platform
+// accepts the tokens of the OAuth client. Failures are logged, the extension starts regardless.
+func (s *Specification) validateOAuth(ctx context.Context) {
+	result, response, err := s.VerifyQuery(ctx, validationQuery)
+	if response != nil && (response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden) {
+		log.Error().Str("tenant", s.tenant).Int("code", response.StatusCode).Msg("The Dynatrace platform rejected the OAuth token. Please check the OAuth client and its scopes.")
+		return
+	}
+	if err != nil {
+		log.Error().Str("tenant", s.tenant).Err(err).Msg("Failed to reach the Dynatrace platform APIs. Please check STEADYBIT_EXTENSION_PLATFORM_BASE_URL and the OAuth client credentials.")
+		return
+	}
+	if !result.Valid {
+		log.Warn().Str("tenant", s.tenant).Interface("notifications", result.Notifications).Msg("The Dynatrace platform didn't accept the validation query.")
+		return
+	}
+	log.Info().Str("tenant", s.tenant).Msg("Verified the OAuth client with the Dynatrace platform APIs.")
+}
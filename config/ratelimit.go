@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-dynatrace/extmetrics"
+	"golang.org/x/time/rate"
+)
+
+// API families with a separate rate limit. Dynatrace limits the requests per tenant and endpoint.
+const (
+	FamilyEvents   = "events"
+	FamilyEntities = "entities"
+	FamilyProblems = "problems"
+	FamilySettings = "settings"
+	FamilyMetrics  = "metrics"
+)
+
+var Families = []string{FamilyEvents, FamilyEntities, FamilyProblems, FamilySettings, FamilyMetrics}
+
+// defaultApiRateLimits are the requests per second per family if ApiRateLimits doesn't configure them
+var defaultApiRateLimits = map[string]float64{
+	FamilyEvents:   10,
+	FamilyEntities: 10,
+	FamilyProblems: 5,
+	FamilySettings: 5,
+	FamilyMetrics:  10,
+}
+
+const (
+	defaultApiRateLimitBurst   = 10
+	defaultApiRateLimitMaxWait = 10 * time.Second
+)
+
+// operationFamilies assigns the operations to the rate limited families. Other operations are not limited.
+var operationFamilies = map[string]string{
+	OperationPostEvent:               FamilyEvents,
+	OperationGetEntities:             FamilyEntities,
+	OperationGetProblems:             FamilyProblems,
+	OperationCreateMaintenanceWindow: FamilySettings,
+	OperationDeleteMaintenanceWindow: FamilySettings,
+	OperationIngestMetrics:           FamilyMetrics,
+	OperationIngestBizEvent:          FamilyEvents,
+}
+
+// ErrThrottled is returned if a request couldn't be sent within ApiRateLimitMaxWait because of the rate limit.
+var ErrThrottled = errors.New("rate limit exceeded")
+
+// rateLimiters holds a token bucket per API family. They are shared by all callers of a tenant.
+type rateLimiters struct {
+	mutex    sync.Mutex
+	spec     *Specification
+	families map[string]*rate.Limiter
+}
+
+func (s *Specification) rateLimiters() *rateLimiters {
+	clientInitMutex.Lock()
+	defer clientInitMutex.Unlock()
+	if s.limiters == nil {
+		s.limiters = &rateLimiters{spec: s, families: map[string]*rate.Limiter{}}
+	}
+	return s.limiters
+}
+
+func (r *rateLimiters) family(family string) *rate.Limiter {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if l, ok := r.families[family]; ok {
+		return l
+	}
+	limit, ok := r.spec.ApiRateLimits[family]
+	if !ok {
+		limit = defaultApiRateLimits[family]
+	}
+	l := rate.NewLimiter(rate.Inf, 0)
+	if limit > 0 {
+		l = rate.NewLimiter(rate.Limit(limit), IntOrDefault(r.spec.ApiRateLimitBurst, defaultApiRateLimitBurst))
+	}
+	r.families[family] = l
+	return l
+}
+
+// waitForRateLimit blocks until the rate limit of the operation's family allows another request. Requests are queued
+// at most ApiRateLimitMaxWait, and never beyond the deadline of ctx.
+func (s *Specification) waitForRateLimit(ctx context.Context, operation string) error {
+	family, ok := operationFamilies[operation]
+	if !ok {
+		return nil
+	}
+	limiter := s.rateLimiters().family(family)
+
+	now := time.Now()
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+
+	maxWait := DurationOrDefault(s.ApiRateLimitMaxWait, defaultApiRateLimitMaxWait)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(now) < maxWait {
+		maxWait = deadline.Sub(now)
+	}
+	if !reservation.OK() || delay > maxWait {
+		reservation.Cancel()
+		extmetrics.ApiThrottled.WithLabelValues(s.tenant, family, "rejected").Inc()
+		log.Warn().Str("tenant", s.tenant).Str("family", family).Str("operation", operation).Dur("delay", delay).Msg("Rate limit of the Dynatrace API exceeded, rejecting request.")
+		return fmt.Errorf("%s request to Dynatrace not sent: %w for %s", operation, ErrThrottled, family)
+	}
+
+	extmetrics.ApiThrottled.WithLabelValues(s.tenant, family, "waited").Inc()
+	log.Debug().Str("tenant", s.tenant).Str("family", family).Str("operation", operation).Dur("delay", delay).Msg("Waiting for the rate limit of the Dynatrace API.")
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		extmetrics.ApiThrottledSeconds.WithLabelValues(s.tenant, family).Add(delay.Seconds())
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		extmetrics.ApiThrottledSeconds.WithLabelValues(s.tenant, family).Add(time.Since(now).Seconds())
+		return fmt.Errorf("%s request to Dynatrace aborted: %w", operation, ctx.Err())
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultApiRetryBudget         = 30 * time.Second
+	defaultApiRetryInitialBackoff = 500 * time.Millisecond
+	defaultApiRetryMaxBackoff     = 10 * time.Second
+)
+
+// shouldRetry decides if a request is sent again. Transient errors are connection errors and the status codes 429,
+// 502, 503 and 504. Requests that are not idempotent (POST) are only retried on 429, because Dynatrace rejected them
+// before processing, unless ApiRetryPost is enabled.
+func (s *Specification) shouldRetry(method string, attempt int, response *http.Response, err error) bool {
+	if attempt > s.ApiMaxRetries {
+		return false
+	}
+	if response != nil && response.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if method == http.MethodPost && !s.ApiRetryPost {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return isTransientStatus(response.StatusCode)
+}
+
+// backoff returns the wait time before the next attempt. A Retry-After header sent by Dynatrace takes precedence,
+// otherwise the wait time grows exponentially with a random jitter.
+func (s *Specification) backoff(attempt int, response *http.Response) time.Duration {
+	if response != nil {
+		if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			return retryAfter
+		}
+	}
+	maxBackoff := DurationOrDefault(s.ApiRetryMaxBackoff, defaultApiRetryMaxBackoff)
+	wait := DurationOrDefault(s.ApiRetryInitialBackoff, defaultApiRetryInitialBackoff)
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, maxBackoff)
+	// equal jitter: wait at least half of the backoff to keep the exponential growth
+	return wait/2 + rand.N(wait/2+1)
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
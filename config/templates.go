@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+)
+
+// EventTemplate replaces the title and adds properties to the Dynatrace events sent for a Steadybit event. Both are
+// Go text/template strings.
+type EventTemplate struct {
+	Title      string            `json:"title"`
+	Properties map[string]string `json:"properties"`
+
+	title      *template.Template
+	properties map[string]*template.Template
+}
+
+// EventTemplates by Steadybit event, parsed from a JSON object, like
+// '{"experiment.started":{"title":"Chaos experiment {{.Event.ExperimentExecution.Name}}","properties":{"ticket":"..."}}}'
+type EventTemplates map[string]*EventTemplate
+
+// Decode implements envconfig.Decoder
+func (t *EventTemplates) Decode(value string) error {
+	if err := json.Unmarshal([]byte(value), t); err != nil {
+		return err
+	}
+	var errs []error
+	for event, eventTemplate := range *t {
+		if eventTemplate == nil {
+			continue
+		}
+		if err := eventTemplate.parse(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *EventTemplate) parse(event string) error {
+	var err error
+	if t.Title != "" {
+		if t.title, err = template.New(event + "/title").Option("missingkey=error").Parse(t.Title); err != nil {
+			return err
+		}
+	}
+	t.properties = make(map[string]*template.Template, len(t.Properties))
+	for key, value := range t.Properties {
+		if t.properties[key], err = template.New(event + "/" + key).Option("missingkey=error").Parse(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderTitle returns the title for the data, or false if the template has no title.
+func (t *EventTemplate) RenderTitle(data any) (string, bool, error) {
+	if t.title == nil {
+		return "", false, nil
+	}
+	title, err := execute(t.title, data)
+	return title, err == nil, err
+}
+
+// RenderProperties returns the properties for the data. Properties failing to render are left out.
+func (t *EventTemplate) RenderProperties(data any) (map[string]string, error) {
+	properties := make(map[string]string, len(t.properties))
+	var errs []error
+	for key, tmpl := range t.properties {
+		value, err := execute(tmpl, data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		properties[key] = value
+	}
+	return properties, errors.Join(errs...)
+}
+
+func execute(tmpl *template.Template, data any) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
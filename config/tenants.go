@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+)
+
+// Tenant is an additional Dynatrace tenant. Events of the listed Steadybit environments and teams are sent to this
+// tenant instead of the default one. Settings that are not set are taken from the default tenant.
+type Tenant struct {
+	Name              string   `json:"name"`
+	Environments      []string `json:"environments"`
+	Teams             []string `json:"teams"`
+	ApiBaseUrl        string   `json:"apiBaseUrl"`
+	UiBaseUrl         string   `json:"uiBaseUrl"`
+	ApiToken          string   `json:"apiToken"`
+	PlatformBaseUrl   string   `json:"platformBaseUrl"`
+	OAuthClientId     string   `json:"oauthClientId"`
+	OAuthClientSecret string   `json:"oauthClientSecret"`
+	OAuthAccountUrn   string   `json:"oauthAccountUrn"`
+}
+
+// TenantList is parsed from a JSON array, like '[{"name":"staging","apiBaseUrl":"...","apiToken":"...","environments":["Staging"]}]'
+type TenantList []Tenant
+
+// Decode implements envconfig.Decoder
+func (l *TenantList) Decode(value string) error {
+	return json.Unmarshal([]byte(value), l)
+}
+
+var (
+	tenantsMutex sync.RWMutex
+	tenants      = map[string]*Specification{}
+	tenantNames  []string
+)
+
+// initTenants creates a Specification per tenant. The default tenant is Config itself.
+func initTenants() error {
+	tenantsMutex.Lock()
+	defer tenantsMutex.Unlock()
+	Config.tenant = Config.DefaultTenantName
+	tenants = map[string]*Specification{Config.tenant: &Config}
+	tenantNames = []string{Config.tenant}
+
+	var errs []error
+	for _, t := range Config.Tenants {
+		if t.Name == "" {
+			errs = append(errs, errors.New("tenant without name"))
+			continue
+		}
+		if _, ok := tenants[t.Name]; ok {
+			errs = append(errs, fmt.Errorf("duplicate tenant '%s'", t.Name))
+			continue
+		}
+		if t.ApiBaseUrl == "" || t.ApiToken == "" {
+			errs = append(errs, fmt.Errorf("tenant '%s' needs an apiBaseUrl and an apiToken", t.Name))
+			continue
+		}
+		tenants[t.Name] = Config.forTenant(t)
+		tenantNames = append(tenantNames, t.Name)
+		log.Info().Str("tenant", t.Name).Strs("environments", t.Environments).Strs("teams", t.Teams).Msg("Configured Dynatrace tenant.")
+	}
+	return errors.Join(errs...)
+}
+
+// forTenant derives the Specification of a tenant. The pooled http client is shared, OAuth tokens and rate limits
+// are not.
+func (s *Specification) forTenant(t Tenant) *Specification {
+	spec := *s
+	spec.tenant = t.Name
+	spec.Tenants = nil
+	spec.oauth = nil
+	spec.limiters = nil
+	spec.ApiBaseUrl = t.ApiBaseUrl
+	spec.ApiToken = t.ApiToken
+	spec.PlatformBaseUrl = t.PlatformBaseUrl
+	if t.UiBaseUrl != "" {
+		spec.UiBaseUrl = t.UiBaseUrl
+	}
+	if t.OAuthClientId != "" {
+		spec.OAuthClientId = t.OAuthClientId
+		spec.OAuthClientSecret = t.OAuthClientSecret
+		spec.OAuthAccountUrn = t.OAuthAccountUrn
+	}
+	return &spec
+}
+
+// TenantName returns the name of the tenant the Specification belongs to.
+func (s *Specification) TenantName() string {
+	return s.tenant
+}
+
+// TenantNames returns the names of all tenants, the default tenant first.
+func TenantNames() []string {
+	tenantsMutex.RLock()
+	defer tenantsMutex.RUnlock()
+	return slices.Clone(tenantNames)
+}
+
+// ForTenant returns the Specification of the tenant with the given name. An empty name selects the default tenant.
+func ForTenant(name string) (*Specification, error) {
+	if name == "" {
+		return &Config, nil
+	}
+	tenantsMutex.RLock()
+	defer tenantsMutex.RUnlock()
+	if spec, ok := tenants[name]; ok {
+		return spec, nil
+	}
+	return nil, fmt.Errorf("unknown Dynatrace tenant '%s'", name)
+}
+
+// ForEvent returns the tenant for events of the given Steadybit environment and team. Teams take precedence over
+// environments, events matching no tenant go to the default tenant.
+func ForEvent(environment string, team string) *Specification {
+	tenantsMutex.RLock()
+	defer tenantsMutex.RUnlock()
+	if team != "" {
+		for _, t := range Config.Tenants {
+			if spec, ok := tenants[t.Name]; ok && slices.Contains(t.Teams, team) {
+				return spec
+			}
+		}
+	}
+	if environment != "" {
+		for _, t := range Config.Tenants {
+			if spec, ok := tenants[t.Name]; ok && slices.Contains(t.Environments, environment) {
+				return spec
+			}
+		}
+	}
+	return &Config
+}
+
+// allTenants returns the Specifications of all tenants, the default tenant first.
+func allTenants() []*Specification {
+	tenantsMutex.RLock()
+	defer tenantsMutex.RUnlock()
+	result := make([]*Specification, 0, len(tenantNames))
+	for _, name := range tenantNames {
+		result = append(result, tenants[name])
+	}
+	return result
+}
+
+// TenantParameter is the action parameter to choose the Dynatrace tenant. It is nil if only the default tenant is
+// configured.
+func TenantParameter(order int) *action_kit_api.ActionParameter {
+	names := TenantNames()
+	if len(names) < 2 {
+		return nil
+	}
+	options := make([]action_kit_api.ParameterOption, 0, len(names))
+	for _, name := range names {
+		options = append(options, action_kit_api.ExplicitParameterOption{Label: name, Value: name})
+	}
+	return &action_kit_api.ActionParameter{
+		Name:         "tenant",
+		Label:        "Dynatrace Tenant",
+		Description:  new("The Dynatrace tenant to use."),
+		Type:         action_kit_api.ActionParameterTypeString,
+		DefaultValue: new(Config.tenant),
+		Options:      new(options),
+		Order:        new(order),
+		Required:     new(true),
+	}
+}
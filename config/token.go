@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-dynatrace/types"
+)
+
+// Scopes of the Dynatrace API token required by the actions and event listeners
+const (
+	ScopeEventsIngest  = "events.ingest"
+	ScopeEntitiesRead  = "entities.read"
+	ScopeProblemsRead  = "problems.read"
+	ScopeSettingsWrite = "settings.write"
+	ScopeMetricsIngest = "metrics.ingest"
+)
+
+// tokenScopes holds the result of the token lookup at startup. A nil value means the scopes are unknown, e.g. because
+// Dynatrace wasn't reachable, and all features stay enabled. With several tenants, only the scopes granted by all
+// tokens are kept.
+var tokenScopes *types.ApiToken
+
+// LookupToken returns the metadata of the configured API token, including its scopes. A token may always look up
+// itself, no additional scope is needed.
+func (s *Specification) LookupToken(ctx context.Context) (*types.ApiToken, *http.Response, error) {
+	b, err := json.Marshal(types.ApiTokenLookupRequest{Token: s.ApiToken})
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to marshal request")
+		return nil, nil, err
+	}
+
+	responseBody, response, err := s.do(ctx, OperationLookupToken, fmt.Sprintf("%s/v2/apiTokens/lookup", s.ApiBaseUrl), "POST", b)
+	if err != nil {
+		return nil, response, err
+	}
+
+	if response.StatusCode != 200 {
+		return nil, response, newApiError(OperationLookupToken, response, responseBody)
+	}
+
+	var result types.ApiToken
+	err = json.Unmarshal(responseBody, &result)
+	if err != nil {
+		log.Error().Err(err).Str("body", string(responseBody)).Msgf("Failed to parse response body")
+		return nil, response, err
+	}
+	return &result, response, nil
+}
+
+// validateToken looks up the token scopes. It returns false if Dynatrace rejected the token.
+func (s *Specification) validateToken(ctx context.Context) bool {
+	token, response, err := s.LookupToken(ctx)
+	if response != nil && (response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden) {
+		log.Error().Str("tenant", s.tenant).Int("code", response.StatusCode).Msg("Dynatrace rejected the API token. Please check STEADYBIT_EXTENSION_API_TOKEN.")
+		return false
+	}
+	if err != nil {
+		log.Warn().Str("tenant", s.tenant).Err(err).Msg("Failed to look up the scopes of the Dynatrace API token. Assuming all required scopes are granted.")
+		return true
+	}
+	if !token.Enabled {
+		log.Error().Str("tenant", s.tenant).Str("token", token.Name).Msg("The Dynatrace API token is disabled.")
+		return false
+	}
+	log.Info().Str("tenant", s.tenant).Str("token", token.Name).Strs("scopes", token.Scopes).Msg("Looked up the scopes of the Dynatrace API token.")
+	if tokenScopes == nil {
+		tokenScopes = token
+	} else {
+		tokenScopes.Scopes = slices.DeleteFunc(slices.Clone(tokenScopes.Scopes), func(scope string) bool {
+			return !slices.Contains(token.Scopes, scope)
+		})
+	}
+	return true
+}
+
+// MissingScopes returns the required scopes that the API token doesn't have.
+func MissingScopes(required ...string) []string {
+	if tokenScopes == nil {
+		return nil
+	}
+	var missing []string
+	for _, scope := range required {
+		if !slices.Contains(tokenScopes.Scopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// HasScopes tells whether the feature can be used with the API token and logs the missing scopes otherwise.
+func HasScopes(feature string, required ...string) bool {
+	missing := MissingScopes(required...)
+	if len(missing) > 0 {
+		log.Error().Strs("missingScopes", missing).Msgf("%s is disabled, the Dynatrace API token is missing the scope(s) %v.", feature, missing)
+		return false
+	}
+	return true
+}
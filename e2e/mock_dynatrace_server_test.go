@@ -20,7 +20,10 @@ func createMockDynatraceServer() *httptest.Server {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Info().Str("path", r.URL.Path).Str("method", r.Method).Str("query", r.URL.RawQuery).Msg("Request received")
 		Requests = append(Requests, fmt.Sprintf("%s-%s", r.Method, r.URL.Path))
-		if r.URL.Path == "/api/v2/settings/objects" && r.Method == http.MethodPost {
+		if r.URL.Path == "/api/v2/apiTokens/lookup" && r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(apiToken())
+		} else if r.URL.Path == "/api/v2/settings/objects" && r.Method == http.MethodPost {
 			w.WriteHeader(http.StatusOK)
 			_, _ = w.Write(maintenanceWindowCreated())
 		} else if strings.HasPrefix(r.URL.Path, "/api/v2/settings/objects/") && r.Method == http.MethodDelete {
@@ -42,6 +45,15 @@ func createMockDynatraceServer() *httptest.Server {
 	return server
 }
 
+func apiToken() []byte {
+	return []byte(`{
+    "id": "dt0c01.MOCKED",
+    "name": "steadybit",
+    "enabled": true,
+    "scopes": ["events.ingest", "entities.read", "problems.read", "settings.write"]
+}`)
+}
+
 func maintenanceWindowCreated() []byte {
 	return []byte(`[
     {
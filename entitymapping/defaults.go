@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package entitymapping
+
+// Defaults returns the rules for the targets of the Steadybit Kubernetes, container, host, JVM, AWS, Azure and GCP
+// extensions.
+func Defaults() *Rules {
+	return &Rules{
+		Selectors: []Rule{
+			{TargetType: "com.steadybit.extension_kubernetes.kubernetes-cluster", EntityType: "KUBERNETES_CLUSTER", EntityName: "{k8s.cluster-name}"},
+			{TargetType: "com.steadybit.extension_kubernetes.kubernetes-deployment", EntityType: "CLOUD_APPLICATION", EntityName: "{k8s.deployment}"},
+			{TargetType: "com.steadybit.extension_kubernetes.kubernetes-statefulset", EntityType: "CLOUD_APPLICATION", EntityName: "{k8s.statefulset}"},
+			{TargetType: "com.steadybit.extension_kubernetes.kubernetes-daemonset", EntityType: "CLOUD_APPLICATION", EntityName: "{k8s.daemonset}"},
+			{TargetType: "com.steadybit.extension_kubernetes.kubernetes-node", EntityType: "KUBERNETES_NODE", EntityName: "{k8s.node.name}"},
+			{TargetType: "com.steadybit.extension_kubernetes.kubernetes-pod", EntityType: "CLOUD_APPLICATION_INSTANCE", EntityName: "{k8s.pod.name}"},
+			{TargetType: "com.steadybit.extension_jvm.application", EntityType: "CLOUD_APPLICATION_INSTANCE", EntityName: "{k8s.pod.name}"},
+			{TargetType: "com.steadybit.extension_container.container", EntityType: "CONTAINER_GROUP_INSTANCE", EntityName: "{k8s.pod.name} {k8s.container.name}"},
+			{TargetType: "com.steadybit.extension_host.host", Require: []string{"k8s.cluster-name"}, EntityType: "KUBERNETES_NODE", EntityName: "{host.hostname}"},
+			{TargetType: "com.steadybit.extension_host.host", EntityType: "HOST", EntityName: "{host.hostname}"},
+
+			// Cloud resources are matched by their ID or ARN, their names only if Dynatrace doesn't know the ID. Dynatrace
+			// names EC2 instances after their Name tag, which several instances may share, or their ID if they have none.
+			// Dynatrace has no entity for single ECS tasks, so their events aren't attached to an entity.
+			{TargetType: "com.steadybit.extension_aws.ec2_instance", EntityType: "EC2_INSTANCE", EntityAttribute: "awsInstanceId", EntityName: "{aws-ec2.instance.id}"},
+			{TargetType: "com.steadybit.extension_aws.ec2_instance", EntityType: "EC2_INSTANCE", EntityName: "{aws-ec2.instance.id}"},
+			{TargetType: "com.steadybit.extension_aws.ec2_instance", EntityType: "EC2_INSTANCE", EntityName: "{aws-ec2.instance.name}"},
+			{TargetType: "com.steadybit.extension_aws.lambda", EntityType: "AWS_LAMBDA_FUNCTION", EntityAttribute: "arn", EntityName: "{aws.arn}"},
+			{TargetType: "com.steadybit.extension_aws.lambda", EntityType: "AWS_LAMBDA_FUNCTION", EntityName: "{aws.lambda.function-name}"},
+			{TargetType: "com.steadybit.extension_aws.rds.instance", EntityType: "RELATIONAL_DATABASE_SERVICE", EntityName: "{aws.rds.instance.id}"},
+			{TargetType: "com.steadybit.extension_azure.scale_set.instance", EntityType: "AZURE_VM", EntityAttribute: "azureResourceId", EntityName: "{azure-vm.vm.id}"},
+			{TargetType: "com.steadybit.extension_azure.scale_set.instance", EntityType: "AZURE_VM", EntityName: "{azure-vm.vm.name}"},
+			{TargetType: "com.steadybit.extension_azure.vm", EntityType: "AZURE_VM", EntityAttribute: "azureResourceId", EntityName: "{azure-vm.vm.id}"},
+			{TargetType: "com.steadybit.extension_azure.vm", EntityType: "AZURE_VM", EntityName: "{azure-vm.vm.name}"},
+			{TargetType: "com.steadybit.extension_gcp.vm", EntityType: "cloud:gcp:gce_instance", EntityName: "{gcp-vm.name}"},
+			{TargetType: "com.steadybit.extension_gcp.vm", EntityType: "cloud:gcp:gce_instance", EntityName: "{gcp-vm.id}"},
+		},
+		Properties: []PropertyRule{
+			{Property: "dt.entity.kubernetes_cluster", Rule: Rule{EntityType: "KUBERNETES_CLUSTER", EntityName: "{k8s.cluster-name}"}},
+			{Property: "dt.entity.cloud_application_namespace", Rule: Rule{EntityType: "CLOUD_APPLICATION_NAMESPACE", EntityName: "{k8s.namespace}"}},
+			{Property: "dt.entity.cloud_application", Rule: Rule{EntityType: "CLOUD_APPLICATION", EntityName: "{k8s.deployment}"}},
+			{Property: "dt.entity.cloud_application_instance", Rule: Rule{EntityType: "CLOUD_APPLICATION_INSTANCE", EntityName: "{k8s.pod.name}"}},
+			{Property: "dt.entity.kubernetes_node", Rule: Rule{Require: []string{"k8s.cluster-name"}, EntityType: "KUBERNETES_NODE", EntityName: "{container.host}"}},
+			{Property: "dt.entity.kubernetes_node", Rule: Rule{Require: []string{"k8s.cluster-name"}, EntityType: "KUBERNETES_NODE", EntityName: "{host.hostname}"}},
+			{Property: "dt.entity.kubernetes_node", Rule: Rule{Require: []string{"k8s.cluster-name"}, EntityType: "KUBERNETES_NODE", EntityName: "{application.hostname}"}},
+			{Property: "dt.entity.kubernetes_node", Rule: Rule{Require: []string{"k8s.cluster-name"}, EntityType: "KUBERNETES_NODE", EntityName: "{k8s.node.name}"}},
+		},
+	}
+}
@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+// Package entitymapping maps Steadybit targets to Dynatrace entities, based on the target type and attributes.
+package entitymapping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rule maps a target to a Dynatrace entity, found by its type and name.
+type Rule struct {
+	// TargetType the rule applies to, all target types if empty
+	TargetType string `json:"targetType,omitempty"`
+	// Require lists attributes the target must have for the rule to apply
+	Require []string `json:"require,omitempty"`
+	// EntityType is the Dynatrace entity type, like CLOUD_APPLICATION
+	EntityType string `json:"entityType"`
+	// EntityName is the name of the entity with placeholders for target attributes, like '{k8s.pod.name} {k8s.container.name}'.
+	// The rule only applies if all attributes have a single value.
+	EntityName string `json:"entityName"`
+	// EntityAttribute matches the entity by this attribute instead of its name, like 'awsInstanceId'. EntityName is the
+	// value of the attribute then, which always needs single values.
+	EntityAttribute string `json:"entityAttribute,omitempty"`
+}
+
+// PropertyRule adds a property referencing the entity, like dt.entity.kubernetes_cluster, to the event.
+type PropertyRule struct {
+	Rule
+	Property string `json:"property"`
+}
+
+// Rules are evaluated in order.
+type Rules struct {
+	// Selectors determine the entity an event is attached to. The first matching rule whose entity exists wins.
+	Selectors []Rule `json:"selectors"`
+	// Properties add references to further entities. If several rules set a property, the last one whose entity exists
+	// wins.
+	Properties []PropertyRule `json:"properties"`
+}
+
+// File is the format of the rule file. Its rules are evaluated in addition to the defaults and take precedence.
+type File struct {
+	Rules
+	// ReplaceDefaults evaluates only the rules of the file.
+	ReplaceDefaults bool `json:"replaceDefaults"`
+}
+
+// PropertySelector is a property to add to the event if the entity exists.
+type PropertySelector struct {
+	Property string
+	Selector string
+}
+
+var placeholder = regexp.MustCompile(`\{([^{}]+)}`)
+
+// Load reads the rules from a JSON file, see File. Without path, the defaults are returned.
+func Load(path string) (*Rules, error) {
+	if path == "" {
+		return Defaults(), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := file.validate(); err != nil {
+		return nil, fmt.Errorf("invalid rules in %s: %w", path, err)
+	}
+	if file.ReplaceDefaults {
+		return &file.Rules, nil
+	}
+	defaults := Defaults()
+	return &Rules{
+		Selectors:  append(file.Selectors, defaults.Selectors...),
+		Properties: append(defaults.Properties, file.Properties...),
+	}, nil
+}
+
+func (r *Rules) validate() error {
+	var errs []error
+	for i, rule := range r.Selectors {
+		if err := rule.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("selector %d: %w", i, err))
+		}
+	}
+	for i, rule := range r.Properties {
+		if err := rule.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("property %d: %w", i, err))
+		}
+		if rule.Property == "" {
+			errs = append(errs, fmt.Errorf("property %d: property is missing", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Rule) validate() error {
+	if r.EntityType == "" {
+		return errors.New("entityType is missing")
+	}
+	if !placeholder.MatchString(r.EntityName) {
+		return errors.New("entityName has no attribute placeholder")
+	}
+	return nil
+}
+
+// EntitySelectors returns the entity selectors of the matching selector rules in order. The first one whose entity
+// exists wins. Attributes with multiple values match by all of them, up to maxNames entity names per selector. With
+// maxNames 1, rules using such attributes don't apply.
+func (r *Rules) EntitySelectors(targetType string, attributes map[string][]string, maxNames int) []string {
+	var result []string
+	for _, rule := range r.Selectors {
+		if selector, ok := rule.apply(targetType, attributes, maxNames); ok {
+			result = append(result, selector)
+		}
+	}
+	return result
+}
+
+// PropertySelectors returns the selectors of the matching property rules in order. If several exist for a property,
+// the last one whose entity exists wins. See EntitySelectors for maxNames.
+func (r *Rules) PropertySelectors(targetType string, attributes map[string][]string, maxNames int) []PropertySelector {
+	var result []PropertySelector
+	for _, rule := range r.Properties {
+		if selector, ok := rule.apply(targetType, attributes, maxNames); ok {
+			result = append(result, PropertySelector{Property: rule.Property, Selector: selector})
+		}
+	}
+	return result
+}
+
+func (r *Rule) apply(targetType string, attributes map[string][]string, maxNames int) (string, bool) {
+	if r.TargetType != "" && r.TargetType != targetType {
+		return "", false
+	}
+	for _, attribute := range r.Require {
+		if _, ok := attributes[attribute]; !ok {
+			return "", false
+		}
+	}
+	if r.EntityAttribute != "" {
+		maxNames = 1
+	}
+	names := r.names(attributes, max(maxNames, 1))
+	if len(names) == 0 {
+		return "", false
+	}
+	if r.EntityAttribute != "" {
+		return fmt.Sprintf("type(%s),%s(%s)", r.EntityType, r.EntityAttribute, quote(names[0])), true
+	}
+	return NameSelector(r.EntityType, names), true
+}
+
+// NameSelector returns the selector of the entities of the type with one of the names.
+func NameSelector(entityType string, names []string) string {
+	if len(names) == 1 {
+		return fmt.Sprintf("type(%s),entityName.equals(%s)", entityType, names[0])
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quote(name)
+	}
+	return fmt.Sprintf("type(%s),entityName.in(%s)", entityType, strings.Join(quoted, ","))
+}
+
+// names returns the entity names with the placeholders replaced, one per combination of attribute values, up to
+// maxNames.
+func (r *Rule) names(attributes map[string][]string, maxNames int) []string {
+	names := []string{""}
+	last := 0
+	for _, match := range placeholder.FindAllStringSubmatchIndex(r.EntityName, -1) {
+		literal := r.EntityName[last:match[0]]
+		values := attributes[r.EntityName[match[2]:match[3]]]
+		if len(values) == 0 || (len(values) > 1 && maxNames == 1) {
+			// We don't map one-to-many attributes by default. For example when attacking a host, we don't want to add all namespaces or pods which are running on that host.
+			return nil
+		}
+		var next []string
+	combine:
+		for _, name := range names {
+			for _, value := range values {
+				if len(next) == maxNames {
+					break combine
+				}
+				next = append(next, name+literal+value)
+			}
+		}
+		names = next
+		last = match[1]
+	}
+	for i := range names {
+		names[i] += r.EntityName[last:]
+	}
+	return names
+}
+
+// quote returns the value as quoted string of an entity selector, escaping quotes and tildes with a tilde.
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`~`, `~~`, `"`, `~"`).Replace(value) + `"`
+}
+
+var nameSelector = regexp.MustCompile(`^type\(([^()]+)\),entityName\.(equals|in)\((.*)\)$`)
+
+// ParseSelector returns the entity type and names of a selector created by the rules. Lookups of entities of the same
+// type can be combined into a single entityName.in selector.
+func ParseSelector(selector string) (entityType string, names []string, ok bool) {
+	match := nameSelector.FindStringSubmatch(selector)
+	if match == nil {
+		return "", nil, false
+	}
+	if match[2] == "equals" {
+		return match[1], []string{match[3]}, true
+	}
+	names, ok = unquoteList(match[3])
+	return match[1], names, ok
+}
+
+// unquoteList parses a comma separated list of quoted strings, see quote.
+func unquoteList(list string) ([]string, bool) {
+	var names []string
+	for len(list) > 0 {
+		if list[0] != '"' {
+			return nil, false
+		}
+		var name strings.Builder
+		i := 1
+		for ; i < len(list) && list[i] != '"'; i++ {
+			if list[i] == '~' {
+				i++
+				if i == len(list) {
+					return nil, false
+				}
+			}
+			name.WriteByte(list[i])
+		}
+		if i == len(list) {
+			return nil, false
+		}
+		names = append(names, name.String())
+		list = list[i+1:]
+		if len(list) > 0 {
+			if list[0] != ',' || len(list) == 1 {
+				return nil, false
+			}
+			list = list[1:]
+		}
+	}
+	return names, len(names) > 0
+}
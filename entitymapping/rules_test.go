@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package entitymapping
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaults_EntitySelectors(t *testing.T) {
+	tests := []struct {
+		name       string
+		targetType string
+		attributes map[string][]string
+		want       []string
+	}{
+		{
+			name:       "container",
+			targetType: "com.steadybit.extension_container.container",
+			attributes: map[string][]string{"k8s.pod.name": {"checkout-4711"}, "k8s.container.name": {"app"}},
+			want:       []string{"type(CONTAINER_GROUP_INSTANCE),entityName.equals(checkout-4711 app)"},
+		},
+		{
+			name:       "host in a kubernetes cluster",
+			targetType: "com.steadybit.extension_host.host",
+			attributes: map[string][]string{"host.hostname": {"node-1"}, "k8s.cluster-name": {"prod"}},
+			want:       []string{"type(KUBERNETES_NODE),entityName.equals(node-1)", "type(HOST),entityName.equals(node-1)"},
+		},
+		{
+			name:       "host",
+			targetType: "com.steadybit.extension_host.host",
+			attributes: map[string][]string{"host.hostname": {"vm-1"}},
+			want:       []string{"type(HOST),entityName.equals(vm-1)"},
+		},
+		{
+			name:       "ec2 instance",
+			targetType: "com.steadybit.extension_aws.ec2_instance",
+			attributes: map[string][]string{"aws-ec2.instance.id": {"i-0abc"}, "aws-ec2.instance.name": {"checkout-1"}, "aws.region": {"eu-central-1"}},
+			want: []string{
+				`type(EC2_INSTANCE),awsInstanceId("i-0abc")`,
+				"type(EC2_INSTANCE),entityName.equals(i-0abc)",
+				"type(EC2_INSTANCE),entityName.equals(checkout-1)",
+			},
+		},
+		{
+			name:       "ec2 instance without name",
+			targetType: "com.steadybit.extension_aws.ec2_instance",
+			attributes: map[string][]string{"aws-ec2.instance.id": {"i-0abc"}},
+			want:       []string{`type(EC2_INSTANCE),awsInstanceId("i-0abc")`, "type(EC2_INSTANCE),entityName.equals(i-0abc)"},
+		},
+		{
+			name:       "ecs task",
+			targetType: "com.steadybit.extension_aws.ecs-task",
+			attributes: map[string][]string{"aws-ecs.task.arn": {"arn:aws:ecs:eu-central-1:123:task/shop/abc"}, "aws-ecs.service.name": {"checkout"}},
+		},
+		{
+			name:       "lambda function",
+			targetType: "com.steadybit.extension_aws.lambda",
+			attributes: map[string][]string{"aws.lambda.function-name": {"resize-images"}, "aws.arn": {"arn:aws:lambda:eu-central-1:123:function:resize-images"}},
+			want: []string{
+				`type(AWS_LAMBDA_FUNCTION),arn("arn:aws:lambda:eu-central-1:123:function:resize-images")`,
+				"type(AWS_LAMBDA_FUNCTION),entityName.equals(resize-images)",
+			},
+		},
+		{
+			name:       "rds instance",
+			targetType: "com.steadybit.extension_aws.rds.instance",
+			attributes: map[string][]string{"aws.rds.instance.id": {"orders-db"}},
+			want:       []string{"type(RELATIONAL_DATABASE_SERVICE),entityName.equals(orders-db)"},
+		},
+		{
+			name:       "azure vm",
+			targetType: "com.steadybit.extension_azure.vm",
+			attributes: map[string][]string{"azure-vm.vm.name": {"checkout-vm"}, "azure-vm.vm.id": {"/subscriptions/1/resourceGroups/shop/providers/Microsoft.Compute/virtualMachines/checkout-vm"}},
+			want: []string{
+				`type(AZURE_VM),azureResourceId("/subscriptions/1/resourceGroups/shop/providers/Microsoft.Compute/virtualMachines/checkout-vm")`,
+				"type(AZURE_VM),entityName.equals(checkout-vm)",
+			},
+		},
+		{
+			name:       "azure scale set instance",
+			targetType: "com.steadybit.extension_azure.scale_set.instance",
+			attributes: map[string][]string{"azure-vm.vm.name": {"checkout_0"}, "azure-vm.vm.id": {"/subscriptions/1/resourceGroups/shop/providers/Microsoft.Compute/virtualMachineScaleSets/checkout/virtualMachines/0"}},
+			want: []string{
+				`type(AZURE_VM),azureResourceId("/subscriptions/1/resourceGroups/shop/providers/Microsoft.Compute/virtualMachineScaleSets/checkout/virtualMachines/0")`,
+				"type(AZURE_VM),entityName.equals(checkout_0)",
+			},
+		},
+		{
+			name:       "gcp vm",
+			targetType: "com.steadybit.extension_gcp.vm",
+			attributes: map[string][]string{"gcp-vm.name": {"checkout-vm"}, "gcp-vm.id": {"4711"}},
+			want:       []string{"type(cloud:gcp:gce_instance),entityName.equals(checkout-vm)", "type(cloud:gcp:gce_instance),entityName.equals(4711)"},
+		},
+		{
+			name:       "attribute with multiple values",
+			targetType: "com.steadybit.extension_kubernetes.kubernetes-deployment",
+			attributes: map[string][]string{"k8s.deployment": {"a", "b"}},
+		},
+		{
+			name:       "unknown target type",
+			targetType: "com.example.custom",
+			attributes: map[string][]string{"k8s.deployment": {"checkout"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Defaults().EntitySelectors(tt.targetType, tt.attributes, 1))
+		})
+	}
+}
+
+func TestRules_EntityAttribute(t *testing.T) {
+	rules := &Rules{Selectors: []Rule{{EntityType: "EC2_INSTANCE", EntityAttribute: "awsInstanceId", EntityName: "{aws-ec2.instance.id}"}}}
+
+	assert.Equal(t, []string{`type(EC2_INSTANCE),awsInstanceId("i-0~"abc")`}, rules.EntitySelectors("any", map[string][]string{"aws-ec2.instance.id": {`i-0"abc`}}, 10))
+	assert.Empty(t, rules.EntitySelectors("any", map[string][]string{"aws-ec2.instance.id": {"i-1", "i-2"}}, 10))
+}
+
+func TestDefaults_PropertySelectors(t *testing.T) {
+	got := Defaults().PropertySelectors("com.steadybit.extension_container.container", map[string][]string{
+		"k8s.cluster-name": {"prod"},
+		"k8s.namespace":    {"ns-1", "ns-2"},
+		"k8s.pod.name":     {"checkout-4711"},
+		"container.host":   {"node-1"},
+		"k8s.node.name":    {"node-1"},
+	}, 1)
+
+	assert.Equal(t, []PropertySelector{
+		{Property: "dt.entity.kubernetes_cluster", Selector: "type(KUBERNETES_CLUSTER),entityName.equals(prod)"},
+		{Property: "dt.entity.cloud_application_instance", Selector: "type(CLOUD_APPLICATION_INSTANCE),entityName.equals(checkout-4711)"},
+		{Property: "dt.entity.kubernetes_node", Selector: "type(KUBERNETES_NODE),entityName.equals(node-1)"},
+		{Property: "dt.entity.kubernetes_node", Selector: "type(KUBERNETES_NODE),entityName.equals(node-1)"},
+	}, got)
+}
+
+func TestRules_MultipleValues(t *testing.T) {
+	rules := &Rules{Selectors: []Rule{{EntityType: "CONTAINER_GROUP_INSTANCE", EntityName: "{k8s.pod.name} {k8s.container.name}"}}}
+	attributes := map[string][]string{"k8s.pod.name": {"pod-1", "pod-2"}, "k8s.container.name": {"app", `say "hi"`}}
+
+	assert.Empty(t, rules.EntitySelectors("any", attributes, 1))
+	assert.Equal(t, []string{`type(CONTAINER_GROUP_INSTANCE),entityName.in("pod-1 app","pod-1 say ~"hi~"","pod-2 app")`}, rules.EntitySelectors("any", attributes, 3))
+	assert.Equal(t, []string{`type(CONTAINER_GROUP_INSTANCE),entityName.equals(pod-1 app)`},
+		rules.EntitySelectors("any", map[string][]string{"k8s.pod.name": {"pod-1"}, "k8s.container.name": {"app"}}, 3))
+}
+
+func TestLoad_FileRulesTakePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"selectors": [
+			{"targetType": "com.steadybit.extension_kubernetes.kubernetes-deployment", "entityType": "SERVICE", "entityName": "{k8s.namespace}/{k8s.deployment}"},
+			{"targetType": "com.example.custom", "entityType": "PROCESS_GROUP", "entityName": "{custom.name}"}
+		],
+		"properties": [
+			{"property": "dt.entity.kubernetes_cluster", "entityType": "KUBERNETES_CLUSTER", "entityName": "{k8s.cluster-name}-renamed"}
+		]
+	}`), 0600))
+
+	rules, err := Load(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"type(SERVICE),entityName.equals(shop/checkout)", "type(CLOUD_APPLICATION),entityName.equals(checkout)"},
+		rules.EntitySelectors("com.steadybit.extension_kubernetes.kubernetes-deployment", map[string][]string{"k8s.namespace": {"shop"}, "k8s.deployment": {"checkout"}}, 1))
+	assert.Equal(t, []string{"type(PROCESS_GROUP),entityName.equals(billing)"}, rules.EntitySelectors("com.example.custom", map[string][]string{"custom.name": {"billing"}}, 1))
+	assert.Equal(t, []string{"type(HOST),entityName.equals(vm-1)"}, rules.EntitySelectors("com.steadybit.extension_host.host", map[string][]string{"host.hostname": {"vm-1"}}, 1))
+	properties := rules.PropertySelectors("com.example.custom", map[string][]string{"k8s.cluster-name": {"prod"}}, 1)
+	assert.Equal(t, "type(KUBERNETES_CLUSTER),entityName.equals(prod-renamed)", properties[len(properties)-1].Selector)
+}
+
+func TestLoad_ReplaceDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"replaceDefaults": true, "selectors": [{"entityType": "HOST", "entityName": "{host.hostname}"}]}`), 0600))
+
+	rules, err := Load(path)
+
+	require.NoError(t, err)
+	assert.Len(t, rules.Selectors, 1)
+	assert.Empty(t, rules.Properties)
+}
+
+func TestLoad_RejectsInvalidRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"selectors": [{"entityType": "HOST", "entityName": "static"}], "properties": [{"entityName": "{host.hostname}"}]}`), 0600))
+
+	_, err := Load(path)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "selector 0: entityName has no attribute placeholder")
+	assert.Contains(t, err.Error(), "property 0: entityType is missing")
+	assert.Contains(t, err.Error(), "property 0: property is missing")
+}
+
+func TestLoad_WithoutFileReturnsDefaults(t *testing.T) {
+	rules, err := Load("")
+
+	require.NoError(t, err)
+	assert.Equal(t, Defaults(), rules)
+}
+
+func TestParseSelector(t *testing.T) {
+	rule := Rule{EntityType: "CLOUD_APPLICATION_INSTANCE", EntityName: "{k8s.pod.name}"}
+	selector, ok := rule.apply("", map[string][]string{"k8s.pod.name": {`pod-"1"`, "pod~2", "pod,3"}}, 10)
+	require.True(t, ok)
+
+	entityType, names, ok := ParseSelector(selector)
+
+	assert.True(t, ok)
+	assert.Equal(t, "CLOUD_APPLICATION_INSTANCE", entityType)
+	assert.Equal(t, []string{`pod-"1"`, "pod~2", "pod,3"}, names)
+
+	entityType, names, ok = ParseSelector("type(HOST),entityName.equals(node-1)")
+	assert.True(t, ok)
+	assert.Equal(t, "HOST", entityType)
+	assert.Equal(t, []string{"node-1"}, names)
+
+	for _, selector := range []string{`entityId("HOST-1")`, `type(HOST),entityName.in("a",)`, `type(HOST),entityName.in("a)`, `type(HOST),tag(a)`} {
+		_, _, ok = ParseSelector(selector)
+		assert.False(t, ok, selector)
+	}
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+)
+
+const bizEventSource = "steadybit"
+
+// bizEventTypes are the types of the business events per listener path
+var bizEventTypes = map[string]string{
+	"/events/experiment-started":          "com.steadybit.experiment.started",
+	"/events/experiment-completed":        "com.steadybit.experiment.completed",
+	"/events/experiment-step-completed":   "com.steadybit.experiment.step.completed",
+	"/events/experiment-target-started":   "com.steadybit.experiment.step.target.started",
+	"/events/experiment-target-completed": "com.steadybit.experiment.step.target.completed",
+}
+
+// sendsEvents reports whether Dynatrace events are sent, see config.Specification.EventOutput.
+func sendsEvents() bool {
+	return config.Config.EventOutput != config.EventOutputBizEvents
+}
+
+// sendsBizEvents reports whether business events are sent, see config.Specification.EventOutput.
+func sendsBizEvents() bool {
+	return config.Config.EventOutput == config.EventOutputBizEvents || config.Config.EventOutput == config.EventOutputBoth
+}
+
+// newBizEvent returns the business event for the Steadybit event received on the path. The Dynatrace event built for
+// it provides the title, the entities and the enrichments, like the failure reason of checks.
+func newBizEvent(path string, event *event_kit_api.EventRequestBody, ingest *types.EventIngest) *types.BizEvent {
+	eventType, ok := bizEventTypes[path]
+	if !ok {
+		return nil
+	}
+	id := event.Id
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	data := types.BizEventData{
+		PrincipalType: principalType(event.Principal),
+		PrincipalName: principalName(event.Principal),
+		FailureReason: ingest.Properties["steadybit.failure.reason"],
+		Title:         ingest.Title,
+	}
+	if ingest.EntitySelector != nil {
+		data.EntitySelector = *ingest.EntitySelector
+	}
+	if event.Environment != nil {
+		data.Environment = event.Environment.Name
+	}
+	if event.Team != nil {
+		data.Team = event.Team.Key
+	}
+
+	step := event.ExperimentStepExecution
+	switch {
+	case event.ExperimentStepTargetExecution != nil:
+		target := event.ExperimentStepTargetExecution
+		data.ExecutionId = float64(target.ExecutionId)
+		data.ExperimentKey = target.ExperimentKey
+		data.State = string(target.State)
+		data.TargetName = getTargetName(*target)
+		data.TargetType = target.TargetType
+		data.StartedAt, data.EndedAt = target.StartedTime, target.EndedTime
+		if stepExecution, ok := stepExecutions.get(target.StepExecutionId); ok {
+			step = &stepExecution
+		}
+	case step != nil:
+		data.ExecutionId = float64(step.ExecutionId)
+		data.ExperimentKey = step.ExperimentKey
+		data.State = string(step.State)
+		data.StartedAt, data.EndedAt = step.StartedTime, step.EndedTime
+	case event.ExperimentExecution != nil:
+		execution := event.ExperimentExecution
+		data.ExecutionId = float64(execution.ExecutionId)
+		data.ExperimentKey = execution.ExperimentKey
+		data.ExperimentName = execution.Name
+		data.State = string(execution.State)
+		if !execution.StartedTime.IsZero() {
+			data.StartedAt = &execution.StartedTime
+		}
+		data.EndedAt = execution.EndedTime
+		if path == "/events/experiment-completed" {
+			data.TargetsAttacked = new(takeAttackedTargets(execution.ExecutionId))
+		}
+	}
+	if step != nil {
+		data.StepId = step.Id.String()
+		if step.ActionId != nil {
+			data.ActionId = *step.ActionId
+			data.ActionName = getActionName(*step)
+		}
+		if step.ActionKind != nil {
+			data.ActionKind = string(*step.ActionKind)
+		}
+	}
+	if data.StartedAt != nil && data.EndedAt != nil {
+		data.DurationMs = new(data.EndedAt.Sub(*data.StartedAt).Milliseconds())
+	}
+
+	eventTime := event.EventTime
+	if eventTime.IsZero() {
+		eventTime = time.Now()
+	}
+	return &types.BizEvent{
+		SpecVersion: "1.0",
+		Id:          id.String(),
+		Source:      bizEventSource,
+		Type:        eventType,
+		Time:        eventTime,
+		Data:        data,
+	}
+}
+
+// principalName returns the name of the principal that started the execution, see principalType.
+func principalName(principal any) string {
+	switch p := principal.(type) {
+	case map[string]any:
+		if name, ok := p["name"].(string); ok && name != "" {
+			return name
+		}
+		name, _ := p["username"].(string)
+		return name
+	case event_kit_api.UserPrincipal:
+		return p.Name
+	case event_kit_api.AccessTokenPrincipal:
+		return p.Name
+	case event_kit_api.BatchPrincipal:
+		return p.Username
+	}
+	return ""
+}
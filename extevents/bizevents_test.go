@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newBizEvent_ExperimentCompleted(t *testing.T) {
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	event := &event_kit_api.EventRequestBody{
+		Id:                  uuid.New(),
+		EventTime:           endedTime,
+		Environment:         new(event_kit_api.Environment{Name: "Prod"}),
+		Team:                new(event_kit_api.Team{Key: "OPS"}),
+		Principal:           map[string]any{"principalType": "user", "name": "Jane", "username": "jane"},
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 42, ExperimentKey: "OPS-1", Name: "Pod loss", State: event_kit_api.ExperimentExecutionStateFailed, StartedTime: startedTime, EndedTime: &endedTime}),
+	}
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventOutput = config.EventOutputBizEvents
+	attack := event_kit_api.ExperimentStepExecution{ActionKind: new(event_kit_api.Attack)}
+	for range 3 {
+		countAttackedTarget(&event_kit_api.ExperimentStepTargetExecution{ExecutionId: 42, Id: uuid.New()}, attack)
+	}
+	ingest := &types.EventIngest{
+		Title:          "Steadybit experiment 'OPS-1 / 42' ended",
+		EntitySelector: new(`entityId("HOST-1")`),
+		Properties:     map[string]string{},
+	}
+
+	got := newBizEvent("/events/experiment-completed", event, ingest)
+
+	require.NotNil(t, got)
+	assert.Equal(t, event.Id.String(), got.Id)
+	assert.Equal(t, "steadybit", got.Source)
+	assert.Equal(t, "com.steadybit.experiment.completed", got.Type)
+	assert.Equal(t, types.BizEventData{
+		ExecutionId:     42,
+		ExperimentKey:   "OPS-1",
+		ExperimentName:  "Pod loss",
+		State:           "failed",
+		Environment:     "Prod",
+		Team:            "OPS",
+		PrincipalType:   "user",
+		PrincipalName:   "Jane",
+		StartedAt:       &startedTime,
+		EndedAt:         &endedTime,
+		DurationMs:      new(int64(360000)),
+		TargetsAttacked: new(3),
+		EntitySelector:  `entityId("HOST-1")`,
+		Title:           "Steadybit experiment 'OPS-1 / 42' ended",
+	}, got.Data)
+	assert.Equal(t, 0, attackedTargetCount(42))
+}
+
+func Test_newBizEvent_TargetCompleted(t *testing.T) {
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 2, 0, 0, time.UTC)
+	step, _, completed := attackEvents(startedTime, endedTime)
+	_, err := onExperimentStepStarted(&step)
+	require.NoError(t, err)
+
+	got := newBizEvent("/events/experiment-target-completed", &completed, &types.EventIngest{Properties: map[string]string{}})
+
+	require.NotNil(t, got)
+	assert.Equal(t, "com.steadybit.experiment.step.target.completed", got.Type)
+	assert.Equal(t, "completed", got.Data.State)
+	assert.Equal(t, "some_action_id", got.Data.ActionId)
+	assert.Equal(t, "attack", got.Data.ActionKind)
+	assert.Equal(t, step.ExperimentStepExecution.Id.String(), got.Data.StepId)
+	assert.Equal(t, "test", got.Data.TargetName)
+	assert.Equal(t, new(int64(60000)), got.Data.DurationMs)
+	assert.Nil(t, got.Data.TargetsAttacked)
+}
+
+func Test_newBizEvent_UnknownPath(t *testing.T) {
+	assert.Nil(t, newBizEvent("/events/experiment-step-started", &event_kit_api.EventRequestBody{}, &types.EventIngest{}))
+}
+
+func Test_processEvent_SendsBizEventsOnly(t *testing.T) {
+	previous, previousQueue := config.Config, queue
+	t.Cleanup(func() { config.Config, queue = previous, previousQueue })
+	config.Config.EventOutput = config.EventOutputBizEvents
+	queue = newEventQueue(testQueueSpec(), nil)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+
+	processEvent(eventJob{
+		path: "/events/experiment-completed",
+		event: event_kit_api.EventRequestBody{
+			Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+			ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 93, ExperimentKey: "KEY", State: event_kit_api.ExperimentExecutionStateCompleted, EndedTime: &endedTime}),
+		},
+		handler: onExperimentCompleted,
+	})
+
+	require.Len(t, queue.items, 1)
+	require.NotNil(t, queue.items[0].BizEvent)
+	assert.Equal(t, "com.steadybit.experiment.completed", queue.items[0].BizEvent.Type)
+	assert.Equal(t, new(0), queue.items[0].BizEvent.Data.TargetsAttacked)
+}
+
+func Test_deliverToDynatrace_SendsBizEventWithOAuth(t *testing.T) {
+	var received types.BizEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sso/oauth2/token":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"oauth-token","token_type":"Bearer","expires_in":300}`))
+		case "/api/v2/bizevents/ingest":
+			assert.Equal(t, "Bearer oauth-token", r.Header.Get("Authorization"))
+			assert.Equal(t, "application/cloudevent+json", r.Header.Get("Content-Type"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config = config.Specification{
+		ApiBaseUrl:        server.URL + "/api",
+		ApiToken:          "api-token",
+		OAuthClientId:     "client",
+		OAuthClientSecret: "secret",
+		OAuthAccountUrn:   "urn:dtaccount:test",
+		OAuthTokenUrl:     server.URL + "/sso/oauth2/token",
+	}
+
+	err := deliverToDynatrace(context.Background(), &queuedEvent{BizEvent: &types.BizEvent{SpecVersion: "1.0", Type: "com.steadybit.experiment.started", Data: types.BizEventData{ExecutionId: 42}}})
+
+	require.NoError(t, err)
+	assert.Equal(t, "com.steadybit.experiment.started", received.Type)
+	assert.Equal(t, float64(42), received.Data.ExecutionId)
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+)
+
+// openEvent is a Dynatrace event sent for the start of an experiment or attack, waiting for its end.
+type openEvent struct {
+	event       types.EventIngest
+	executionId float32
+}
+
+// openEvents by experiment or target execution, see experimentDurationKey and targetDurationKey. They expire with the
+// timeout sent to Dynatrace, which closes the event itself if its end wasn't received by then.
+var openEvents = ttlcache.New[string, openEvent](ttlcache.WithDisableTouchOnHit[string, openEvent]())
+
+func experimentDurationKey(execution *event_kit_api.ExperimentExecution) string {
+	return fmt.Sprintf("experiment/%g", execution.ExecutionId)
+}
+
+func targetDurationKey(target *event_kit_api.ExperimentStepTargetExecution) string {
+	return "target/" + target.Id.String()
+}
+
+// openDurationEvent turns the event into an open event, closed by Dynatrace after the timeout unless
+// closeDurationEvent is called for the same key. Dynatrace caps the timeout at MaxEventDurationTimeout.
+func openDurationEvent(key string, executionId float32, event *types.EventIngest) *types.EventIngest {
+	timeout := max(int64(min(config.DurationOrDefault(config.Config.EventDurationTimeout, 2*time.Hour), config.MaxEventDurationTimeout).Minutes()), 1)
+	event.EndTime = nil
+	event.Timeout = &timeout
+	opened := *event
+	opened.Properties = maps.Clone(event.Properties)
+	openEvents.Set(key, openEvent{event: opened, executionId: executionId}, time.Duration(timeout)*time.Minute)
+	return event
+}
+
+// closeDurationEvent returns the update closing the event opened for the experiment or target whose end the Steadybit
+// event reports, or nil if none is open. Dynatrace only closes an open event if it receives the same event with an end
+// time, so the update repeats the opened event as is. The events API has no way to close an event by the correlation
+// ID of its ingest result. The outcome of the experiment or target is sent as an event of its own.
+func closeDurationEvent(event *event_kit_api.EventRequestBody) *types.EventIngest {
+	var key string
+	var endTime *time.Time
+	switch {
+	case event.ExperimentStepTargetExecution != nil:
+		key, endTime = targetDurationKey(event.ExperimentStepTargetExecution), event.ExperimentStepTargetExecution.EndedTime
+	case event.ExperimentStepExecution == nil && event.ExperimentExecution != nil:
+		key, endTime = experimentDurationKey(event.ExperimentExecution), event.ExperimentExecution.EndedTime
+	}
+	if endTime == nil {
+		return nil
+	}
+	item, ok := openEvents.GetAndDelete(key)
+	if !ok {
+		return nil
+	}
+	closing := item.Value().event
+	closing.Timeout = nil
+	closing.EndTime = new(endTime.UnixMilli())
+	return &closing
+}
+
+// forgetOpenEvents removes the open events of an ended experiment execution, which will not be closed anymore.
+func forgetOpenEvents(executionId float32) {
+	for key, item := range openEvents.Items() {
+		if strings.HasPrefix(key, "target/") && item.Value().executionId == executionId {
+			openEvents.Delete(key)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func enableEventDurations(t *testing.T) {
+	previous := config.Config
+	config.Config.EventDurations = true
+	config.Config.EventDurationTimeout = 30 * time.Minute
+	t.Cleanup(func() { config.Config = previous })
+}
+
+func attackEvents(startedTime time.Time, endedTime time.Time) (step, started, completed event_kit_api.EventRequestBody) {
+	stepId := uuid.New()
+	step = event_kit_api.EventRequestBody{
+		Environment: new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentStepExecution: new(event_kit_api.ExperimentStepExecution{
+			ExecutionId: 42,
+			Id:          stepId,
+			ActionId:    new("some_action_id"),
+			ActionKind:  extutil.Ptr(event_kit_api.Attack),
+		}),
+	}
+	target := event_kit_api.ExperimentStepTargetExecution{
+		ExecutionId:     42,
+		ExperimentKey:   "ExperimentKey",
+		Id:              uuid.New(),
+		StepExecutionId: stepId,
+		State:           "running",
+		TargetType:      "type",
+		TargetName:      "test",
+		StartedTime:     &startedTime,
+	}
+	started = event_kit_api.EventRequestBody{Environment: step.Environment, ExperimentStepTargetExecution: new(target)}
+	target.State = "completed"
+	target.EndedTime = &endedTime
+	completed = event_kit_api.EventRequestBody{Environment: step.Environment, ExperimentStepTargetExecution: new(target)}
+	return
+}
+
+func Test_durationEvents_AttackSpansStartToEnd(t *testing.T) {
+	enableEventDurations(t)
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	step, started, completed := attackEvents(startedTime, endedTime)
+
+	_, err := onExperimentStepStarted(&step)
+	require.NoError(t, err)
+	opened, err := onExperimentTargetStarted(&started)
+	require.NoError(t, err)
+	sent := *opened
+	ended, err := onExperimentTargetCompleted(&completed)
+	require.NoError(t, err)
+	closed := closeDurationEvent(&completed)
+
+	assert.Equal(t, "Steadybit experiment 'ExperimentKey / 42' - Attack 'some_action_id' - Target 'test'", opened.Title)
+	assert.Equal(t, new(startedTime.UnixMilli()), opened.StartTime)
+	assert.Nil(t, opened.EndTime)
+	assert.Equal(t, new(int64(30)), opened.Timeout)
+
+	// Dynatrace only closes the open event if it receives the same event again
+	require.NotNil(t, closed)
+	sent.EndTime = new(endedTime.UnixMilli())
+	sent.Timeout = nil
+	assert.Equal(t, sent, *closed)
+	assert.Equal(t, "running", closed.Properties["steadybit.execution.target.state"])
+	// Only the update closing the event is sent, the end of the attack has no event of its own
+	assert.Nil(t, ended)
+	stillOpen := openEvents.Has(targetDurationKey(completed.ExperimentStepTargetExecution))
+	assert.False(t, stillOpen)
+}
+
+func Test_durationEvents_ClosesWithoutOpenEvent(t *testing.T) {
+	enableEventDurations(t)
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	step, _, completed := attackEvents(startedTime, endedTime)
+
+	_, err := onExperimentStepStarted(&step)
+	require.NoError(t, err)
+	ended, err := onExperimentTargetCompleted(&completed)
+	require.NoError(t, err)
+
+	assert.Nil(t, closeDurationEvent(&completed))
+	assert.Equal(t, "Steadybit experiment 'ExperimentKey / 42' - Attack 'some_action_id' - Target 'test'", ended.Title)
+	assert.Equal(t, new(startedTime.UnixMilli()), ended.StartTime)
+	assert.Equal(t, new(endedTime.UnixMilli()), ended.EndTime)
+}
+
+func Test_durationEvents_ExperimentEndForgetsOpenAttacks(t *testing.T) {
+	enableEventDurations(t)
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	step, started, _ := attackEvents(startedTime, endedTime)
+	execution := event_kit_api.ExperimentExecution{ExecutionId: 42, ExperimentKey: "ExperimentKey", StartedTime: startedTime, State: "running"}
+
+	opened, err := onExperimentStarted(&event_kit_api.EventRequestBody{Environment: step.Environment, EventTime: startedTime, ExperimentExecution: new(execution)})
+	require.NoError(t, err)
+	_, err = onExperimentStepStarted(&step)
+	require.NoError(t, err)
+	_, err = onExperimentTargetStarted(&started)
+	require.NoError(t, err)
+
+	execution.State = "completed"
+	execution.EndedTime = &endedTime
+	completed := event_kit_api.EventRequestBody{Environment: step.Environment, ExperimentExecution: new(execution)}
+	_, err = onExperimentCompleted(&completed)
+	require.NoError(t, err)
+	closed := closeDurationEvent(&completed)
+
+	require.NotNil(t, closed)
+	assert.Equal(t, "Steadybit experiment 'ExperimentKey / 42'", closed.Title)
+	assert.Equal(t, opened.StartTime, closed.StartTime)
+	assert.Equal(t, new(endedTime.UnixMilli()), closed.EndTime)
+	stillOpen := openEvents.Has(targetDurationKey(started.ExperimentStepTargetExecution))
+	assert.False(t, stillOpen)
+}
+
+func Test_durationEvents_OpenEventsExpireWithTimeout(t *testing.T) {
+	enableEventDurations(t)
+	execution := event_kit_api.ExperimentExecution{ExecutionId: 43, ExperimentKey: "ExperimentKey", StartedTime: time.Now(), State: "running"}
+
+	_, err := onExperimentStarted(&event_kit_api.EventRequestBody{Environment: new(event_kit_api.Environment{Name: "gateway"}), EventTime: execution.StartedTime, ExperimentExecution: new(execution)})
+	require.NoError(t, err)
+
+	item := openEvents.Get(experimentDurationKey(&execution))
+	require.NotNil(t, item)
+	assert.Equal(t, 30*time.Minute, item.TTL())
+	openEvents.Delete(experimentDurationKey(&execution))
+}
+
+func Test_durationEvents_TimeoutIsCappedAtMaximumOfDynatrace(t *testing.T) {
+	enableEventDurations(t)
+	config.Config.EventDurationTimeout = 24 * time.Hour
+	execution := event_kit_api.ExperimentExecution{ExecutionId: 44, ExperimentKey: "ExperimentKey", StartedTime: time.Now(), State: "running"}
+
+	opened, err := onExperimentStarted(&event_kit_api.EventRequestBody{Environment: new(event_kit_api.Environment{Name: "gateway"}), EventTime: execution.StartedTime, ExperimentExecution: new(execution)})
+	require.NoError(t, err)
+
+	assert.Equal(t, new(int64(360)), opened.Timeout)
+	item := openEvents.Get(experimentDurationKey(&execution))
+	require.NotNil(t, item)
+	assert.Equal(t, 6*time.Hour, item.TTL())
+	openEvents.Delete(experimentDurationKey(&execution))
+}
+
+func Test_durationEvents_FailedCheckClosesAsError(t *testing.T) {
+	enableEventDurations(t)
+	config.Config.EventActionKinds = []string{"attack", "check"}
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	step, started, completed := attackEvents(startedTime, endedTime)
+	step.ExperimentStepExecution.ActionKind = extutil.Ptr(event_kit_api.Check)
+	completed.ExperimentStepTargetExecution.State = "failed"
+	completed.ExperimentExecution = new(event_kit_api.ExperimentExecution{Reason: new("Problem found")})
+
+	_, err := onExperimentStepStarted(&step)
+	require.NoError(t, err)
+	opened, err := onExperimentTargetStarted(&started)
+	require.NoError(t, err)
+	failure, err := onExperimentTargetCompleted(&completed)
+	require.NoError(t, err)
+	closed := closeDurationEvent(&completed)
+
+	require.NotNil(t, closed)
+	assert.Equal(t, types.EventTypeCustomInfo, closed.EventType)
+	assert.Equal(t, opened.Title, closed.Title)
+	assert.Equal(t, opened.Properties, closed.Properties)
+
+	assert.Equal(t, types.EventTypeError, failure.EventType)
+	assert.Equal(t, "Steadybit experiment 'ExperimentKey / 42' - Check 'some_action_id' ended - Target 'test'", failure.Title)
+	assert.Equal(t, new(endedTime.UnixMilli()), failure.StartTime)
+	assert.Equal(t, "failed", failure.Properties["steadybit.execution.target.state"])
+	assert.Equal(t, "Problem found", failure.Properties["steadybit.failure.reason"])
+	assert.Equal(t, "Check 'some_action_id' failed: Problem found", failure.Properties["dt.event.description"])
+}
+
+func Test_durationEvents_FailedExperimentIsSentWithTypeAndTemplateOfEnd(t *testing.T) {
+	enableEventDurations(t)
+	config.Config.EventTypes = map[string]string{"experiment.completed/failed": types.EventTypeError}
+	setEventTemplates(t, `{
+		"experiment.started": {"title": "Chaos {{.Event.ExperimentExecution.ExperimentKey}}"},
+		"experiment.completed": {"properties": {"outcome": "{{.Event.ExperimentExecution.State}}"}}
+	}`)
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	environment := new(event_kit_api.Environment{Name: "gateway"})
+	execution := event_kit_api.ExperimentExecution{ExecutionId: 44, ExperimentKey: "ExperimentKey", StartedTime: startedTime, State: "running"}
+
+	opened, err := onExperimentStarted(&event_kit_api.EventRequestBody{Environment: environment, EventTime: startedTime, ExperimentExecution: new(execution)})
+	require.NoError(t, err)
+	execution.State = "failed"
+	execution.EndedTime = &endedTime
+	completed := event_kit_api.EventRequestBody{Environment: environment, ExperimentExecution: new(execution)}
+	ended, err := onExperimentCompleted(&completed)
+	require.NoError(t, err)
+	closed := closeDurationEvent(&completed)
+
+	require.NotNil(t, closed)
+	assert.Equal(t, "Chaos ExperimentKey", closed.Title)
+	assert.Equal(t, opened.EventType, closed.EventType)
+	assert.Equal(t, opened.Properties, closed.Properties)
+	assert.Equal(t, opened.StartTime, closed.StartTime)
+	assert.Equal(t, new(endedTime.UnixMilli()), closed.EndTime)
+
+	assert.Equal(t, types.EventTypeError, ended.EventType)
+	assert.Equal(t, "Steadybit experiment 'ExperimentKey / 44' ended", ended.Title)
+	assert.Equal(t, new(endedTime.UnixMilli()), ended.StartTime)
+	assert.Equal(t, "failed", ended.Properties["steadybit.execution.state"])
+	assert.Equal(t, "failed", ended.Properties["outcome"])
+}
+
+func Test_processEvent_ClosesDurationEventBeforeSendingTheEnd(t *testing.T) {
+	enableEventDurations(t)
+	previousQueue := queue
+	t.Cleanup(func() { queue = previousQueue })
+	queue = newEventQueue(testQueueSpec(), nil)
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	environment := new(event_kit_api.Environment{Name: "gateway"})
+	execution := event_kit_api.ExperimentExecution{ExecutionId: 45, ExperimentKey: "ExperimentKey", StartedTime: startedTime, State: "running"}
+
+	processEvent(eventJob{path: "/events/experiment-started", event: event_kit_api.EventRequestBody{Environment: environment, EventTime: startedTime, ExperimentExecution: new(execution)}, handler: onExperimentStarted})
+	execution.State = "completed"
+	execution.EndedTime = &endedTime
+	processEvent(eventJob{path: "/events/experiment-completed", event: event_kit_api.EventRequestBody{Environment: environment, ExperimentExecution: new(execution)}, handler: onExperimentCompleted})
+
+	require.Len(t, queue.items, 3)
+	opened, closed, ended := queue.items[0].Event, queue.items[1].Event, queue.items[2].Event
+	opened.Timeout = nil
+	opened.EndTime = new(endedTime.UnixMilli())
+	assert.Equal(t, opened, closed)
+	assert.Equal(t, "Steadybit experiment 'ExperimentKey / 45' ended", ended.Title)
+}
+
+func Test_processEvent_ClosesDurationEventOfTargetWithoutSendingTheEnd(t *testing.T) {
+	enableEventDurations(t)
+	previousQueue := queue
+	t.Cleanup(func() { queue = previousQueue })
+	queue = newEventQueue(testQueueSpec(), nil)
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	step, started, completed := attackEvents(startedTime, endedTime)
+	_, err := onExperimentStepStarted(&step)
+	require.NoError(t, err)
+
+	processEvent(eventJob{path: "/events/experiment-target-started", event: started, handler: onExperimentTargetStarted})
+	processEvent(eventJob{path: "/events/experiment-target-completed", event: completed, handler: onExperimentTargetCompleted})
+
+	require.Len(t, queue.items, 2)
+	opened, closed := queue.items[0].Event, queue.items[1].Event
+	opened.Timeout = nil
+	opened.EndTime = new(endedTime.UnixMilli())
+	assert.Equal(t, opened, closed)
+}
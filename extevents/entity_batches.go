@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/entitymapping"
+	"github.com/steadybit/extension-dynatrace/types"
+)
+
+// maxBatchNames limits the entity names per request, to keep the URL short enough
+const maxBatchNames = 50
+
+type getEntitiesFunc func(ctx context.Context, tenant string, entitySelector string) ([]types.Entity, error)
+
+// entityBatcher combines concurrent lookups of entities of the same type into a single entityName.in selector and
+// splits the result by entity name. A lookup is sent right away if no request for the entity type is in flight,
+// lookups arriving while one is are collected for the batch window.
+type entityBatcher struct {
+	window      time.Duration
+	getEntities getEntitiesFunc
+	mu          sync.Mutex
+	pending     map[batchKey]*entityBatch
+	inFlight    map[batchKey]int
+}
+
+type batchKey struct {
+	tenant     string
+	entityType string
+}
+
+type entityBatch struct {
+	names    []string
+	known    map[string]bool
+	done     chan struct{}
+	entities []types.Entity
+	err      error
+}
+
+func newEntityBatcher(window time.Duration, getEntities getEntitiesFunc) *entityBatcher {
+	return &entityBatcher{window: window, getEntities: getEntities, pending: make(map[batchKey]*entityBatch), inFlight: make(map[batchKey]int)}
+}
+
+// getEntitiesOfTenant looks up entities with the API of the tenant.
+func getEntitiesOfTenant(ctx context.Context, tenant string, entitySelector string) ([]types.Entity, error) {
+	spec, err := config.ForTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	entities, response, err := spec.GetEntities(ctx, entitySelector)
+	if err != nil {
+		log.Err(err).Str("entitySelector", entitySelector).Msgf("Failed to find entities. Full response %v", response)
+		return nil, err
+	}
+	return entities.Entities, nil
+}
+
+// lookup returns the IDs of the entities matching the selector. Selectors by entity name are resolved together with
+// the lookups of other entities of the same type within the batch window.
+func (b *entityBatcher) lookup(tenant string, entitySelector string) ([]string, error) {
+	entityType, names, ok := entitymapping.ParseSelector(entitySelector)
+	if !ok || len(names) > maxBatchNames {
+		entities, err := b.getEntities(context.Background(), tenant, entitySelector)
+		return entityIds(entities), err
+	}
+	batch := b.add(batchKey{tenant: tenant, entityType: entityType}, names)
+	<-batch.done
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	var ids []string
+	for _, entity := range batch.entities {
+		for _, name := range names {
+			// Entity names are matched case-insensitively by Dynatrace
+			if strings.EqualFold(entity.DisplayName, name) {
+				ids = append(ids, entity.EntityId)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// add adds the names to the pending batch of the entity type, which is resolved when the batch window ends or the
+// batch is full. Without a request for the entity type in flight, there is nothing to wait for and the names are
+// resolved right away.
+func (b *entityBatcher) add(key batchKey, names []string) *entityBatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batch := b.pending[key]
+	if batch != nil && len(batch.names)+len(names) > maxBatchNames {
+		delete(b.pending, key)
+		b.start(key, batch)
+		batch = nil
+	}
+	if batch == nil {
+		batch = &entityBatch{known: make(map[string]bool), done: make(chan struct{})}
+		if b.inFlight[key] == 0 {
+			batch.add(names)
+			b.start(key, batch)
+			return batch
+		}
+		b.pending[key] = batch
+		time.AfterFunc(b.window, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if b.pending[key] == batch {
+				delete(b.pending, key)
+				b.start(key, batch)
+			}
+		})
+	}
+	batch.add(names)
+	return batch
+}
+
+func (batch *entityBatch) add(names []string) {
+	for _, name := range names {
+		if !batch.known[strings.ToLower(name)] {
+			batch.known[strings.ToLower(name)] = true
+			batch.names = append(batch.names, name)
+		}
+	}
+}
+
+// start resolves the batch in the background. The caller holds the lock.
+func (b *entityBatcher) start(key batchKey, batch *entityBatch) {
+	b.inFlight[key]++
+	go b.resolve(key, batch)
+}
+
+func (b *entityBatcher) resolve(key batchKey, batch *entityBatch) {
+	defer close(batch.done)
+	selector := entitymapping.NameSelector(key.entityType, batch.names)
+	log.Debug().Str("tenant", key.tenant).Int("names", len(batch.names)).Str("entitySelector", selector).Msg("Loading entities from Dynatrace API")
+	batch.entities, batch.err = b.getEntities(context.Background(), key.tenant, selector)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight[key]--; b.inFlight[key] == 0 {
+		delete(b.inFlight, key)
+	}
+}
+
+// prefetchTargetEntities starts looking up the entities of the target of an incoming event. The events of an
+// execution are processed one after the other, but arrive concurrently, like when an experiment attacks many pods at
+// once. Looking up their entities on arrival lets the lookups share a batch, the processing then finds them cached.
+func prefetchTargetEntities(event *event_kit_api.EventRequestBody) {
+	target := event.ExperimentStepTargetExecution
+	if target == nil || entityCache == nil {
+		return
+	}
+	// The step isn't known yet if its event is still waiting for a worker, the entities are looked up when processed then
+	if step, ok := stepExecutions.get(target.StepExecutionId); !ok || !forwardsActionKind(step) || !forwardsEvent(event, &step) {
+		return
+	}
+	go prefetchEntities(entityCache, tenantOf(event).TenantName(), target)
+}
+
+// prefetchEntities looks up the entities of all rules matching the target concurrently, so that the lookups of
+// entities of the same type are resolved in a single request.
+func prefetchEntities(cache *ttlcache.Cache[entityKey, []string], tenant string, target *event_kit_api.ExperimentStepTargetExecution) {
+	rules := config.EntityRules()
+	selectors := rules.EntitySelectors(target.TargetType, target.TargetAttributes, maxEntities())
+	for _, property := range rules.PropertySelectors(target.TargetType, target.TargetAttributes, maxEntities()) {
+		selectors = append(selectors, property.Selector)
+	}
+	var wg sync.WaitGroup
+	for _, selector := range selectors {
+		wg.Go(func() { cache.Get(entityKey{tenant: tenant, selector: selector}) })
+	}
+	wg.Wait()
+}
+
+func entityIds(entities []types.Entity) []string {
+	ids := make([]string, 0, len(entities))
+	for _, entity := range entities {
+		ids = append(ids, entity.EntityId)
+	}
+	return ids
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingEntities returns entities named like the pods requested and records the selectors. Requests take the
+// delay, like a round trip to Dynatrace.
+type recordingEntities struct {
+	mu        sync.Mutex
+	selectors []string
+	delay     time.Duration
+}
+
+func (r *recordingEntities) getEntities(_ context.Context, _ string, entitySelector string) ([]types.Entity, error) {
+	time.Sleep(r.delay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.selectors = append(r.selectors, entitySelector)
+	var entities []types.Entity
+	for i := range 3 {
+		name := fmt.Sprintf("pod-%d", i)
+		selector := strings.ToLower(entitySelector)
+		if strings.Contains(selector, `"`+name+`"`) || strings.HasSuffix(selector, "("+name+")") {
+			entities = append(entities, types.Entity{DisplayName: name, EntityId: fmt.Sprintf("CLOUD_APPLICATION_INSTANCE-%d", i)})
+		}
+	}
+	return entities, nil
+}
+
+func Test_entityBatcher_CombinesLookupsOfSameType(t *testing.T) {
+	recorder := &recordingEntities{delay: 20 * time.Millisecond}
+	batcher := newEntityBatcher(50*time.Millisecond, recorder.getEntities)
+	results := make([][]string, 3)
+
+	var wg sync.WaitGroup
+	for i, name := range []string{"pod-0", "pod-1", "pod-5"} {
+		wg.Go(func() {
+			results[i], _ = batcher.lookup("", "type(CLOUD_APPLICATION_INSTANCE),entityName.equals("+name+")")
+		})
+	}
+	wg.Wait()
+
+	// The first lookup is sent right away, the others are collected meanwhile
+	assert.Len(t, recorder.selectors, 2)
+	assert.Equal(t, []string{"CLOUD_APPLICATION_INSTANCE-0"}, results[0])
+	assert.Equal(t, []string{"CLOUD_APPLICATION_INSTANCE-1"}, results[1])
+	assert.Empty(t, results[2])
+}
+
+func Test_entityBatcher_LimitsNamesPerRequest(t *testing.T) {
+	recorder := &recordingEntities{delay: 20 * time.Millisecond}
+	batcher := newEntityBatcher(50*time.Millisecond, recorder.getEntities)
+
+	var wg sync.WaitGroup
+	for i := range maxBatchNames + 2 {
+		wg.Go(func() {
+			_, _ = batcher.lookup("", fmt.Sprintf("type(CLOUD_APPLICATION_INSTANCE),entityName.equals(other-%d)", i))
+		})
+	}
+	wg.Wait()
+
+	// One lookup sent right away, the others in a full batch and a second one
+	assert.Len(t, recorder.selectors, 3)
+}
+
+func Test_entityBatcher_ResolvesSingleLookupWithoutWindow(t *testing.T) {
+	recorder := &recordingEntities{}
+	batcher := newEntityBatcher(time.Hour, recorder.getEntities)
+
+	ids, err := batcher.lookup("", "type(CLOUD_APPLICATION_INSTANCE),entityName.equals(pod-1)")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CLOUD_APPLICATION_INSTANCE-1"}, ids)
+	ids, err = batcher.lookup("", "type(CLOUD_APPLICATION_INSTANCE),entityName.equals(pod-2)")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CLOUD_APPLICATION_INSTANCE-2"}, ids)
+}
+
+func Test_entityBatcher_LooksUpOtherSelectorsDirectly(t *testing.T) {
+	recorder := &recordingEntities{}
+	batcher := newEntityBatcher(time.Hour, recorder.getEntities)
+
+	ids, err := batcher.lookup("", `entityId("HOST-1")`)
+
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+	assert.Equal(t, []string{`entityId("HOST-1")`}, recorder.selectors)
+}
+
+func Test_entityBatcher_MatchesNamesCaseInsensitively(t *testing.T) {
+	recorder := &recordingEntities{}
+	batcher := newEntityBatcher(time.Millisecond, recorder.getEntities)
+
+	ids, err := batcher.lookup("", "type(CLOUD_APPLICATION_INSTANCE),entityName.equals(POD-1)")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CLOUD_APPLICATION_INSTANCE-1"}, ids)
+}
+
+func Test_entityBatcher_ReportsErrorsToAllLookups(t *testing.T) {
+	batcher := newEntityBatcher(50*time.Millisecond, func(context.Context, string, string) ([]types.Entity, error) {
+		return nil, errors.New("unavailable")
+	})
+	errs := make([]error, 2)
+
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Go(func() {
+			_, errs[i] = batcher.lookup("", fmt.Sprintf("type(HOST),entityName.equals(host-%d)", i))
+		})
+	}
+	wg.Wait()
+
+	assert.Error(t, errs[0])
+	assert.Error(t, errs[1])
+}
+
+func Test_handle_BatchesEntityLookupsOfTargetsArrivingTogether(t *testing.T) {
+	previousCache, previousWorkers, previousQueue := entityCache, workers, queue
+	t.Cleanup(func() { entityCache, workers, queue = previousCache, previousWorkers, previousQueue })
+	recorder := &recordingEntities{delay: 20 * time.Millisecond}
+	entityCache = newEntityCache(newEntityBatcher(50*time.Millisecond, recorder.getEntities))
+	spec := testQueueSpec()
+	spec.EventQueueSize = 100
+	queue = newEventQueue(spec, nil)
+	workers = newWorkerPool(4, 100, processEvent)
+	step, _, _ := attackEvents(time.Now(), time.Now())
+	_, err := onExperimentStepStarted(&step)
+	require.NoError(t, err)
+	handler := handle(onExperimentTargetStarted)
+
+	// The platform sends the events of an experiment attacking many pods at once, the worker processes them in order
+	const pods = 30
+	var wg sync.WaitGroup
+	for i := range pods {
+		wg.Go(func() {
+			body, err := json.Marshal(event_kit_api.EventRequestBody{
+				Environment: step.Environment,
+				ExperimentStepTargetExecution: new(event_kit_api.ExperimentStepTargetExecution{
+					ExecutionId:      42,
+					Id:               uuid.New(),
+					StepExecutionId:  step.ExperimentStepExecution.Id,
+					StartedTime:      new(time.Now()),
+					TargetType:       "com.steadybit.extension_kubernetes.kubernetes-pod",
+					TargetName:       fmt.Sprintf("pod-%d", i),
+					TargetAttributes: map[string][]string{"k8s.pod.name": {fmt.Sprintf("pod-%d", i)}},
+				}),
+			})
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			handler(recorder, httptest.NewRequest(http.MethodPost, "/events/experiment-target-started", nil), body)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+		})
+	}
+	wg.Wait()
+	workers.stop()
+
+	require.Len(t, queue.items, pods)
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.LessOrEqual(t, len(recorder.selectors), 3, "one request per pod without batching")
+	for _, item := range queue.items {
+		if strings.HasSuffix(item.Event.Title, "'pod-1'") {
+			assert.Equal(t, new("type(CLOUD_APPLICATION_INSTANCE),entityName.equals(pod-1)"), item.Event.EntitySelector)
+		}
+	}
+}
+
+func Test_newEntityCache_CachesMissingEntitiesShorter(t *testing.T) {
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EntityCacheNegativeTtl = 2 * time.Minute
+	cache := newEntityCache(newEntityBatcher(time.Millisecond, (&recordingEntities{}).getEntities))
+
+	found := cache.Get(entityKey{selector: "type(CLOUD_APPLICATION_INSTANCE),entityName.equals(pod-1)"})
+	missing := cache.Get(entityKey{selector: "type(CLOUD_APPLICATION_INSTANCE),entityName.equals(pod-9)"})
+
+	assert.Equal(t, []string{"CLOUD_APPLICATION_INSTANCE-1"}, found.Value())
+	assert.Equal(t, 30*time.Minute, found.TTL())
+	assert.Empty(t, missing.Value())
+	assert.Equal(t, 2*time.Minute, missing.TTL())
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+)
+
+// Names of the Steadybit events, used as keys of the event type mapping
+const (
+	eventExperimentStarted   = "experiment.started"
+	eventExperimentCompleted = "experiment.completed"
+	eventTargetStarted       = "experiment.step.target.started"
+	eventTargetCompleted     = "experiment.step.target.completed"
+	eventStepCompleted       = "experiment.step.completed"
+)
+
+const (
+	maxPropertyKeyLength   = 100
+	maxPropertyValueLength = 4096
+)
+
+// eventTypeProperties lists the reserved properties (prefixed with dt.) an event type may set. Dynatrace rejects other
+// reserved properties, except for the entity references dt.entity.*.
+var eventTypeProperties = map[string][]string{
+	types.EventTypeCustomDeployment:    {"dt.event.deployment.", "dt.event.is_rootcause_relevant"},
+	types.EventTypeCustomConfiguration: {"dt.event.is_rootcause_relevant"},
+	types.EventTypeAvailability:        {"dt.event.description", "dt.event.allow_davis_merge", "dt.davis."},
+	types.EventTypeCustomAlert:         {"dt.event.description", "dt.event.allow_davis_merge", "dt.davis."},
+	types.EventTypeError:               {"dt.event.description", "dt.event.allow_davis_merge", "dt.davis."},
+	types.EventTypePerformance:         {"dt.event.description", "dt.event.allow_davis_merge", "dt.davis."},
+	types.EventTypeResourceContention:  {"dt.event.description", "dt.event.allow_davis_merge", "dt.davis."},
+}
+
+// eventType returns the Dynatrace event type configured for the Steadybit event in the given execution state. A
+// mapping for the event and state, like 'experiment.completed/failed', wins over one for the event alone.
+func eventType(name string, state string) string {
+	return eventTypeOr(name, state, types.EventTypeCustomInfo)
+}
+
+// eventTypeOr is like eventType, but with the given event type if none is configured.
+func eventTypeOr(name string, state string, defaultType string) string {
+	if eventType, ok := config.Config.EventTypes[name+"/"+state]; ok && state != "" {
+		return eventType
+	}
+	if eventType, ok := config.Config.EventTypes[name]; ok {
+		return eventType
+	}
+	return defaultType
+}
+
+// validateProperties removes the properties Dynatrace doesn't accept for the type of the event and shortens values
+// exceeding the maximum length, so the event isn't rejected as a whole.
+func validateProperties(event *types.EventIngest) {
+	for key, value := range event.Properties {
+		if len(key) > maxPropertyKeyLength || !isAllowedProperty(event.EventType, key) {
+			log.Warn().Str("eventType", event.EventType).Str("property", key).Msg("Dropping property not allowed by Dynatrace for the event type.")
+			delete(event.Properties, key)
+		} else if len(value) > maxPropertyValueLength {
+			log.Warn().Str("property", key).Int("length", len(value)).Msg("Truncating property value exceeding the maximum length.")
+			event.Properties[key] = value[:maxPropertyValueLength]
+		}
+	}
+}
+
+func isAllowedProperty(eventType string, key string) bool {
+	if !strings.HasPrefix(key, "dt.") || strings.HasPrefix(key, "dt.entity.") {
+		return true
+	}
+	for _, allowed := range eventTypeProperties[eventType] {
+		if key == allowed || (strings.HasSuffix(allowed, ".") && strings.HasPrefix(key, allowed)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_eventType(t *testing.T) {
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventTypes = map[string]string{
+		"experiment.started":          types.EventTypeCustomAnnotation,
+		"experiment.completed/failed": types.EventTypeError,
+	}
+
+	assert.Equal(t, types.EventTypeCustomAnnotation, eventType(eventExperimentStarted, "running"))
+	assert.Equal(t, types.EventTypeError, eventType(eventExperimentCompleted, "failed"))
+	assert.Equal(t, types.EventTypeCustomInfo, eventType(eventExperimentCompleted, "completed"))
+	assert.Equal(t, types.EventTypeCustomInfo, eventType(eventTargetStarted, ""))
+}
+
+func Test_onExperimentCompleted_UsesMappedEventType(t *testing.T) {
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventTypes = map[string]string{"experiment.completed/errored": types.EventTypeError}
+
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	got, err := onExperimentCompleted(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 7, ExperimentKey: "KEY", State: "errored", EndedTime: &endedTime}),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, types.EventTypeError, got.EventType)
+}
+
+func Test_validateProperties(t *testing.T) {
+	event := &types.EventIngest{
+		EventType: types.EventTypeCustomInfo,
+		Properties: map[string]string{
+			"steadybit.experiment.key":    "KEY",
+			"dt.entity.cloud_application": "CLOUD_APPLICATION-1",
+			"dt.event.description":        "not allowed for info events",
+			strings.Repeat("k", 101):      "key too long",
+			"steadybit.experiment.name":   strings.Repeat("v", 5000),
+		},
+	}
+
+	validateProperties(event)
+
+	assert.Equal(t, map[string]string{
+		"steadybit.experiment.key":    "KEY",
+		"dt.entity.cloud_application": "CLOUD_APPLICATION-1",
+		"steadybit.experiment.name":   strings.Repeat("v", 4096),
+	}, event.Properties)
+}
+
+func Test_validateProperties_AllowsReservedPropertiesOfType(t *testing.T) {
+	event := &types.EventIngest{
+		EventType: types.EventTypeError,
+		Properties: map[string]string{
+			"dt.event.description":        "Experiment failed",
+			"dt.davis.is_merging_allowed": "false",
+			"dt.event.deployment.name":    "not a deployment",
+		},
+	}
+
+	validateProperties(event)
+
+	assert.Equal(t, map[string]string{
+		"dt.event.description":        "Experiment failed",
+		"dt.davis.is_merging_allowed": "false",
+	}, event.Properties)
+}
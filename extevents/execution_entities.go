@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/jellydator/ttlcache/v3"
+)
+
+// entitySet collects the entities of the targets of an experiment execution, in the order they were seen.
+type entitySet struct {
+	mutex sync.Mutex
+	ids   []string
+}
+
+// executionEntities by experiment execution ID, until the experiment ends or the state TTL expires
+var executionEntities = ttlcache.New[float32, *entitySet](ttlcache.WithDisableTouchOnHit[float32, *entitySet]())
+
+// rememberEntities adds the entities of a target to its experiment execution.
+func rememberEntities(executionId float32, ids []string) {
+	item, _ := executionEntities.GetOrSet(executionId, &entitySet{}, ttlcache.WithTTL[float32, *entitySet](executionStateTtl()))
+	set := item.Value()
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	for _, id := range ids {
+		if !slices.Contains(set.ids, id) {
+			set.ids = append(set.ids, id)
+		}
+	}
+}
+
+// peekEntities returns the entities of an experiment execution seen so far.
+func peekEntities(executionId float32) []string {
+	item := executionEntities.Get(executionId)
+	if item == nil {
+		return nil
+	}
+	set := item.Value()
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	return slices.Clone(set.ids)
+}
+
+// takeEntities returns and forgets the entities of an experiment execution.
+func takeEntities(executionId float32) []string {
+	item, ok := executionEntities.GetAndDelete(executionId)
+	if !ok {
+		return nil
+	}
+	set := item.Value()
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	return set.ids
+}
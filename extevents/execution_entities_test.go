@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_onExperimentCompleted_AttachesEntitiesOfAllTargets(t *testing.T) {
+	mockEntities(t, map[string][]string{
+		"type(HOST),entityName.equals(vm-1)": {"HOST-1"},
+		"type(HOST),entityName.equals(vm-2)": {"HOST-2"},
+	})
+	for _, hostname := range []string{"vm-1", "vm-2", "vm-1"} {
+		getEntitySelector("", event_kit_api.ExperimentStepTargetExecution{
+			ExecutionId:      77,
+			TargetType:       "com.steadybit.extension_host.host",
+			TargetAttributes: map[string][]string{"host.hostname": {hostname}},
+		}, map[string]string{})
+	}
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+
+	got, err := onExperimentCompleted(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 77, ExperimentKey: "KEY", StartedTime: startedTime, EndedTime: &endedTime}),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, new(`entityId("HOST-1","HOST-2")`), got.EntitySelector)
+	assert.Equal(t, new(startedTime.UnixMilli()), got.StartTime)
+	assert.Equal(t, new(endedTime.UnixMilli()), got.EndTime)
+	assert.Empty(t, takeEntities(77))
+}
+
+func Test_onExperimentCompleted_WithEventDurationsClosesWithEntitiesOfOpen(t *testing.T) {
+	enableEventDurations(t)
+	rememberEntities(81, []string{"HOST-1"})
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+	execution := event_kit_api.ExperimentExecution{ExecutionId: 81, ExperimentKey: "KEY", StartedTime: startedTime}
+
+	opened, err := onExperimentStarted(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		EventTime:           startedTime,
+		ExperimentExecution: new(execution),
+	})
+	require.NoError(t, err)
+	rememberEntities(81, []string{"HOST-2"})
+	execution.EndedTime = &endedTime
+	completed := event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentExecution: new(execution),
+	}
+	closed := closeDurationEvent(&completed)
+	ended, err := onExperimentCompleted(&completed)
+	require.NoError(t, err)
+
+	assert.Equal(t, new(`entityId("HOST-1")`), opened.EntitySelector)
+	require.NotNil(t, closed)
+	assert.Equal(t, opened.EntitySelector, closed.EntitySelector)
+	assert.Equal(t, new(`entityId("HOST-1","HOST-2")`), ended.EntitySelector)
+	assert.Equal(t, new(endedTime.UnixMilli()), ended.StartTime)
+	assert.Equal(t, new(endedTime.UnixMilli()), ended.EndTime)
+}
+
+func Test_onExperimentCompleted_LimitsExperimentEntities(t *testing.T) {
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventMaxExperimentEntities = 1
+	rememberEntities(78, []string{"HOST-1", "HOST-2"})
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+
+	got, err := onExperimentCompleted(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 78, ExperimentKey: "KEY", EndedTime: &endedTime}),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, new(`entityId("HOST-1")`), got.EntitySelector)
+	assert.Equal(t, "experiment targeted 2 entities", got.Properties["steadybit.entities.truncated"])
+}
+
+func Test_onExperimentCompleted_WithoutEntities(t *testing.T) {
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+
+	got, err := onExperimentCompleted(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 79, ExperimentKey: "KEY", EndedTime: &endedTime}),
+	})
+
+	require.NoError(t, err)
+	assert.Nil(t, got.EntitySelector)
+	assert.Equal(t, new(endedTime.UnixMilli()), got.StartTime)
+}
+
+func Test_rememberEntities_ExpireWithStateTtl(t *testing.T) {
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventStateTtl = time.Hour
+	rememberEntities(80, []string{"HOST-1"})
+	rememberEntities(80, []string{"HOST-2"})
+
+	item := executionEntities.Get(80)
+	require.NotNil(t, item)
+	assert.Equal(t, time.Hour, item.TTL())
+	assert.Equal(t, []string{"HOST-1", "HOST-2"}, takeEntities(80))
+}
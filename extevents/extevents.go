@@ -13,57 +13,111 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/steadybit/event-kit/go/event_kit_api"
 	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/extmetrics"
 	"github.com/steadybit/extension-dynatrace/types"
 	extension_kit "github.com/steadybit/extension-kit"
 	"github.com/steadybit/extension-kit/exthttp"
 	"net/http"
-	"sync"
+	"slices"
+	"strings"
 	"time"
 )
 
+// OptionalScopes are the scopes of the API token needed to attach events to Dynatrace entities
+var OptionalScopes = []string{config.ScopeEntitiesRead}
+
+// RequiredScopes returns the scopes the Dynatrace API token needs to forward events. Business events are sent with
+// an OAuth token instead.
+func RequiredScopes() []string {
+	if config.Config.EventOutput == config.EventOutputBizEvents {
+		return nil
+	}
+	return []string{config.ScopeEventsIngest}
+}
+
 func RegisterEventListenerHandlers() {
-	loader := ttlcache.LoaderFunc[string, string](
-		func(c *ttlcache.Cache[string, string], key string) *ttlcache.Item[string, string] {
-			log.Debug().Str("entitySelector", key).Msg("Loading entity from Dynatrace API")
-			entities, response, err := config.Config.GetEntities(context.Background(), key)
-			if err != nil {
-				log.Err(err).Str("entitySelector", key).Msgf("Failed to find entities. Full response %v", response)
-			} else if response.StatusCode != 200 {
-				log.Error().Str("entitySelector", key).Msgf("Dynatrace API responded with unexpected status code %d while getting entities.", response.StatusCode)
-			} else if len(entities.Entities) > 1 {
-				log.Warn().Str("entitySelector", key).Msgf("Found multiple matching entities %+v", entities.Entities)
-			} else if len(entities.Entities) == 1 {
-				log.Debug().Str("entitySelector", key).Msgf("Successfully loaded entity %s", entities.Entities[0].EntityId)
-				item := c.Set(key, entities.Entities[0].EntityId, ttlcache.DefaultTTL)
-				return item
-			}
-			log.Debug().Str("entitySelector", key).Msg("Entity not found. Caching empty result")
-			item := c.Set(key, "", ttlcache.DefaultTTL)
-			return item
-		},
-	)
-	entityCache = ttlcache.New[string, string](
-		ttlcache.WithLoader[string, string](loader),
-		ttlcache.WithTTL[string, string](30*time.Minute),
-	)
+	entityCache = newEntityCache(newEntityBatcher(config.DurationOrDefault(config.Config.EntityLookupBatchWindow, 50*time.Millisecond), getEntitiesOfTenant))
 	go entityCache.Start()
+	go openEvents.Start()
+	go executionEntities.Start()
+	go attackedTargets.Start()
+	workers = newWorkerPool(config.Config.EventWorkers, config.Config.EventWorkerBacklog, processEvent)
+	startEventQueue()
+	startStepStore()
+	startMetricIngest()
+	registerMetrics()
 
 	exthttp.RegisterHttpHandlerWithLogLevel("/events/experiment-started", handle(onExperimentStarted), zerolog.DebugLevel)
 	exthttp.RegisterHttpHandlerWithLogLevel("/events/experiment-completed", handle(onExperimentCompleted), zerolog.DebugLevel)
 	exthttp.RegisterHttpHandlerWithLogLevel("/events/experiment-step-started", handle(onExperimentStepStarted), zerolog.DebugLevel)
+	exthttp.RegisterHttpHandlerWithLogLevel("/events/experiment-step-completed", handle(onExperimentStepCompleted), zerolog.DebugLevel)
 	exthttp.RegisterHttpHandlerWithLogLevel("/events/experiment-target-started", handle(onExperimentTargetStarted), zerolog.DebugLevel)
 	exthttp.RegisterHttpHandlerWithLogLevel("/events/experiment-target-completed", handle(onExperimentTargetCompleted), zerolog.DebugLevel)
 }
 
+func registerMetrics() {
+	extmetrics.RegisterCounterFunc("entity_cache_hits_total", "Entity lookups answered from the cache.", func() float64 {
+		return float64(entityCache.Metrics().Hits)
+	})
+	extmetrics.RegisterCounterFunc("entity_cache_misses_total", "Entity lookups that required a request to Dynatrace.", func() float64 {
+		return float64(entityCache.Metrics().Misses)
+	})
+	extmetrics.RegisterGaugeFunc("entity_cache_size", "Entities in the cache, including cached empty results.", func() float64 {
+		return float64(entityCache.Len())
+	})
+	extmetrics.RegisterGaugeFunc("event_worker_backlog", "Incoming events waiting for or being processed by a worker.", func() float64 {
+		return float64(workers.depth())
+	})
+	extmetrics.RegisterGaugeFunc("event_queue_size", "Events waiting for delivery to Dynatrace.", func() float64 {
+		return float64(queue.len())
+	})
+	extmetrics.RegisterGaugeFunc("step_executions", "Step executions remembered until their experiment ends.", func() float64 {
+		return float64(stepExecutions.len())
+	})
+}
+
 type PostEventApi interface {
 	PostEvent(ctx context.Context, event types.EventIngest) (*types.EventIngestResults, *http.Response, error)
 	GetEntities(ctx context.Context, entitySelect string) (*types.EntitiesList, *http.Response, error)
 }
 
-var (
-	stepExecutions = sync.Map{}
-	entityCache    *ttlcache.Cache[string, string]
-)
+var entityCache *ttlcache.Cache[entityKey, []string]
+
+// newEntityCache returns the cache of entity lookups. Lookups finding no entity are cached shorter, so that new
+// entities are found quickly.
+func newEntityCache(batcher *entityBatcher) *ttlcache.Cache[entityKey, []string] {
+	loader := ttlcache.LoaderFunc[entityKey, []string](
+		func(c *ttlcache.Cache[entityKey, []string], key entityKey) *ttlcache.Item[entityKey, []string] {
+			ids, err := batcher.lookup(key.tenant, key.selector)
+			switch {
+			case err != nil:
+				// logged with the response by getEntitiesOfTenant
+			case len(ids) > 1:
+				log.Debug().Str("entitySelector", key.selector).Msgf("Found multiple matching entities %v", ids)
+			case len(ids) == 1:
+				log.Debug().Str("entitySelector", key.selector).Msgf("Successfully loaded entity %s", ids[0])
+			default:
+				log.Debug().Str("entitySelector", key.selector).Msg("Entity not found. Caching empty result")
+			}
+			if len(ids) == 0 {
+				return c.Set(key, nil, config.DurationOrDefault(config.Config.EntityCacheNegativeTtl, time.Minute))
+			}
+			return c.Set(key, ids, ttlcache.DefaultTTL)
+		},
+	)
+	return ttlcache.New[entityKey, []string](
+		// Lookups of a selector that is already loading wait for it, like the prefetched entities of a target
+		ttlcache.WithLoader[entityKey, []string](ttlcache.NewSuppressedLoader[entityKey, []string](loader, nil)),
+		ttlcache.WithTTL[entityKey, []string](30*time.Minute),
+	)
+}
+
+// entityKey identifies a cached entity lookup, whose value are the IDs of the matching entities. The same selector
+// matches different entities in different tenants.
+type entityKey struct {
+	tenant   string
+	selector string
+}
 
 type eventHandler func(event *event_kit_api.EventRequestBody) (*types.EventIngest, error)
 
@@ -76,59 +130,163 @@ func handle(handler eventHandler) func(w http.ResponseWriter, r *http.Request, b
 			return
 		}
 
-		go func() {
-			if request, err := handler(&event); err == nil {
-				if request != nil {
-					sendDynatraceEvent(&config.Config, request)
-				}
-			}
-		}()
+		if event.ExperimentStepExecution == nil && (!forwardsExecution(&event) || (event.ExperimentStepTargetExecution == nil && !forwardsEvent(&event, nil))) {
+			// The step of target events is only known in the worker, so their handlers apply the filters on actions.
+			// Step events are filtered by their handlers, started steps are remembered regardless.
+			extmetrics.EventsForwarded.WithLabelValues(r.URL.Path, "filtered").Inc()
+			exthttp.WriteBody(w, "{}")
+			return
+		}
+
+		prefetchTargetEntities(&event)
+
+		// The event is processed by a worker and delivered by the queue, which retries it if Dynatrace isn't reachable.
+		// The response is delayed only while all workers are busy. Events that can't be taken over, because the
+		// request ended or the extension is shutting down, are rejected so the platform sends them again.
+		job := eventJob{path: r.URL.Path, event: event, handler: handler}
+		if !workers.submit(r.Context(), orderingKey(&event), job) {
+			extmetrics.EventsForwarded.WithLabelValues(job.path, "failure").Inc()
+			writeUnavailable(w, "The event can't be processed right now, the extension is busy or shutting down.")
+			return
+		}
 
 		exthttp.WriteBody(w, "{}")
 	}
 }
 
+// writeUnavailable responds with status 503, which the platform retries, unlike the status 500 of exthttp.WriteError.
+func writeUnavailable(w http.ResponseWriter, title string) {
+	log.Warn().Msg(title)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err := json.NewEncoder(w).Encode(extension_kit.ExtensionError{Title: title}); err != nil {
+		log.Err(err).Msg("Failed to write response body")
+	}
+}
+
+func processEvent(job eventJob) {
+	request, err := job.handler(&job.event)
+	if err != nil {
+		extmetrics.EventsForwarded.WithLabelValues(job.path, "failure").Inc()
+		return
+	}
+	// The end of an experiment or target closes the duration event opened for it, before its own event is sent
+	closing := closeDurationEvent(&job.event)
+	if request == nil && closing == nil {
+		extmetrics.EventsForwarded.WithLabelValues(job.path, "skipped").Inc()
+		return
+	}
+	tenant, key := tenantOf(&job.event).TenantName(), orderingKey(&job.event)
+	for _, ingest := range []*types.EventIngest{closing, request} {
+		if ingest == nil {
+			continue
+		}
+		validateProperties(ingest)
+		if sendsEvents() {
+			queue.enqueue(tenant, key, job.path, ingest)
+		}
+	}
+	if sendsBizEvents() {
+		if request == nil {
+			request = closing
+		}
+		if bizEvent := newBizEvent(job.path, &job.event, request); bizEvent != nil {
+			queue.enqueueBizEvent(tenant, key, job.path, bizEvent)
+		}
+	}
+}
+
+// tenantOf returns the Dynatrace tenant the event is sent to, based on the Steadybit environment and team.
+func tenantOf(event *event_kit_api.EventRequestBody) *config.Specification {
+	environment, team := "", ""
+	if event.Environment != nil {
+		environment = event.Environment.Name
+	}
+	if event.Team != nil {
+		team = event.Team.Key
+	}
+	return config.ForEvent(environment, team)
+}
+
 func onExperimentStarted(event *event_kit_api.EventRequestBody) (*types.EventIngest, error) {
 	props := make(map[string]string)
 	addBaseProperties(props, event)
 	addExperimentExecutionProperties(props, event.ExperimentExecution)
-	return &types.EventIngest{
-		EventType:  "CUSTOM_INFO",
+	ingest := &types.EventIngest{
+		EventType:  eventType(eventExperimentStarted, string(event.ExperimentExecution.State)),
 		Title:      fmt.Sprintf("Steadybit experiment '%s / %g' started", event.ExperimentExecution.ExperimentKey, event.ExperimentExecution.ExecutionId),
 		Properties: props,
 		StartTime:  new(event.EventTime.UnixMilli()),
 		EndTime:    new(event.EventTime.UnixMilli()),
-	}, nil
+	}
+	if config.Config.EventDurations {
+		ingest.Title = experimentTitle(event.ExperimentExecution)
+		applyEventTemplate(eventExperimentStarted, ingest, event, nil)
+		// Dynatrace only closes the event with the same entity selector, so it is attached to the entities known when opened
+		attachEntities(ingest, peekEntities(event.ExperimentExecution.ExecutionId))
+		return openDurationEvent(experimentDurationKey(event.ExperimentExecution), event.ExperimentExecution.ExecutionId, ingest), nil
+	}
+	applyEventTemplate(eventExperimentStarted, ingest, event, nil)
+	return ingest, nil
+}
+
+func experimentTitle(execution *event_kit_api.ExperimentExecution) string {
+	return fmt.Sprintf("Steadybit experiment '%s / %g'", execution.ExperimentKey, execution.ExecutionId)
 }
 
 func onExperimentCompleted(event *event_kit_api.EventRequestBody) (*types.EventIngest, error) {
 	log.Info().Str("experimentKey", event.ExperimentExecution.ExperimentKey).Float32("executionId", event.ExperimentExecution.ExecutionId).Str("status", string(event.ExperimentExecution.State)).Msg("Received event about ended experiment.")
-	stepExecutions.Range(func(key, value any) bool {
-		stepExecution := value.(event_kit_api.ExperimentStepExecution)
-		if stepExecution.ExecutionId == event.ExperimentExecution.ExecutionId {
-			log.Debug().Msgf("Delete step execution data for id %.0f", stepExecution.ExecutionId)
-			stepExecutions.Delete(key)
-		}
-		return true
-	})
+	stepExecutions.deleteExecution(event.ExperimentExecution.ExecutionId)
+	forgetOpenEvents(event.ExperimentExecution.ExecutionId)
+	recordExperimentMetrics(event, attackedTargetCount(event.ExperimentExecution.ExecutionId))
+	if !sendsBizEvents() {
+		// Otherwise the business event of the ended experiment reports and forgets the targets, see newBizEvent
+		takeAttackedTargets(event.ExperimentExecution.ExecutionId)
+	}
 
 	props := make(map[string]string)
 	addBaseProperties(props, event)
 	addExperimentExecutionProperties(props, event.ExperimentExecution)
-	return &types.EventIngest{
-		EventType:  "CUSTOM_INFO",
+	ingest := &types.EventIngest{
+		EventType:  eventType(eventExperimentCompleted, string(event.ExperimentExecution.State)),
 		Title:      fmt.Sprintf("Steadybit experiment '%s / %g' ended", event.ExperimentExecution.ExperimentKey, event.ExperimentExecution.ExecutionId),
 		Properties: props,
 		StartTime:  new(event.ExperimentExecution.EndedTime.UnixMilli()),
 		EndTime:    new(event.ExperimentExecution.EndedTime.UnixMilli()),
-	}, nil
+	}
+	// With EventDurations, this event reports the outcome besides the update closing the event of the experiment
+	applyEventTemplate(eventExperimentCompleted, ingest, event, nil)
+	attachExperimentEntities(ingest, event.ExperimentExecution)
+	return ingest, nil
+}
+
+// attachExperimentEntities attaches the event of an ended experiment to the entities of all its targets. Without
+// EventDurations, the event then spans the whole execution, so it shows the experiment window on the timeline of each
+// entity. With EventDurations, it stays at the end, next to the event spanning the experiment.
+func attachExperimentEntities(ingest *types.EventIngest, execution *event_kit_api.ExperimentExecution) {
+	if attachEntities(ingest, takeEntities(execution.ExecutionId)) && !config.Config.EventDurations {
+		ingest.StartTime = new(execution.StartedTime.UnixMilli())
+	}
+}
+
+// attachEntities attaches the event to the entities of an experiment, at most EventMaxExperimentEntities of them.
+func attachEntities(ingest *types.EventIngest, ids []string) bool {
+	if len(ids) == 0 {
+		return false
+	}
+	if maxIds := config.IntOrDefault(config.Config.EventMaxExperimentEntities, 100); len(ids) > maxIds {
+		ingest.Properties["steadybit.entities.truncated"] = fmt.Sprintf("experiment targeted %d entities", len(ids))
+		ids = ids[:maxIds]
+	}
+	ingest.EntitySelector = new(entityIdSelector(ids))
+	return true
 }
 
 func onExperimentStepStarted(event *event_kit_api.EventRequestBody) (*types.EventIngest, error) {
 	if event.ExperimentStepExecution == nil {
 		return nil, errors.New("missing ExperimentStepExecution in event")
 	}
-	stepExecutions.Store(event.ExperimentStepExecution.Id, *event.ExperimentStepExecution)
+	stepExecutions.store(*event.ExperimentStepExecution)
 	return nil, nil
 }
 
@@ -137,31 +295,42 @@ func onExperimentTargetStarted(event *event_kit_api.EventRequestBody) (*types.Ev
 		return nil, errors.New("missing ExperimentStepTargetExecution in event")
 	}
 
-	var v, ok = stepExecutions.Load(event.ExperimentStepTargetExecution.StepExecutionId)
+	stepExecution, ok := stepExecutions.get(event.ExperimentStepTargetExecution.StepExecutionId)
 	if !ok {
 		log.Warn().Msgf("Could not find step infos for step execution id %s", event.ExperimentStepTargetExecution.StepExecutionId)
 		return nil, nil
 	}
-	stepExecution := v.(event_kit_api.ExperimentStepExecution)
 
-	if stepExecution.ActionKind != nil && *stepExecution.ActionKind == event_kit_api.Attack {
+	if !forwardsEvent(event, &stepExecution) {
+		// The filters on actions apply once the step is known, see handle
+		return nil, nil
+	}
+
+	if forwardsActionKind(stepExecution) {
+		tenant := tenantOf(event).TenantName()
 		props := make(map[string]string)
 		addBaseProperties(props, event)
 		addStepExecutionProperties(props, &stepExecution)
-		addTargetExecutionProperties(props, event.ExperimentStepTargetExecution)
-
-		return &types.EventIngest{
-			EventType: "CUSTOM_INFO",
-			Title: fmt.Sprintf("Steadybit experiment '%s / %g' - Attack '%s' started - Target '%s'",
-				event.ExperimentStepTargetExecution.ExperimentKey,
-				event.ExperimentStepTargetExecution.ExecutionId,
-				getActionName(stepExecution),
-				getTargetName(*event.ExperimentStepTargetExecution)),
+		prefetchEntities(entityCache, tenant, event.ExperimentStepTargetExecution)
+		addTargetExecutionProperties(props, tenant, event.ExperimentStepTargetExecution)
+
+		countAttackedTarget(event.ExperimentStepTargetExecution, stepExecution)
+
+		ingest := &types.EventIngest{
+			EventType:      eventType(eventTargetStarted, string(event.ExperimentStepTargetExecution.State)),
+			Title:          targetTitle(event.ExperimentStepTargetExecution, stepExecution, " started"),
 			Properties:     props,
-			EntitySelector: getEntitySelector(*event.ExperimentStepTargetExecution),
+			EntitySelector: getEntitySelector(tenant, *event.ExperimentStepTargetExecution, props),
 			StartTime:      new(event.ExperimentStepTargetExecution.StartedTime.UnixMilli()),
 			EndTime:        new(event.ExperimentStepTargetExecution.StartedTime.UnixMilli()),
-		}, nil
+		}
+		if config.Config.EventDurations {
+			ingest.Title = targetTitle(event.ExperimentStepTargetExecution, stepExecution, "")
+			applyEventTemplate(eventTargetStarted, ingest, event, &stepExecution)
+			return openDurationEvent(targetDurationKey(event.ExperimentStepTargetExecution), event.ExperimentStepTargetExecution.ExecutionId, ingest), nil
+		}
+		applyEventTemplate(eventTargetStarted, ingest, event, &stepExecution)
+		return ingest, nil
 	}
 
 	return nil, nil
@@ -172,35 +341,73 @@ func onExperimentTargetCompleted(event *event_kit_api.EventRequestBody) (*types.
 		return nil, errors.New("missing ExperimentStepTargetExecution in event")
 	}
 
-	var v, ok = stepExecutions.Load(event.ExperimentStepTargetExecution.StepExecutionId)
+	stepExecution, ok := stepExecutions.get(event.ExperimentStepTargetExecution.StepExecutionId)
 	if !ok {
 		log.Warn().Msgf("Could not find step infos for step execution id %s", event.ExperimentStepTargetExecution.StepExecutionId)
 		return nil, nil
 	}
-	stepExecution := v.(event_kit_api.ExperimentStepExecution)
 
-	if stepExecution.ActionKind != nil && *stepExecution.ActionKind == event_kit_api.Attack {
+	if !forwardsEvent(event, &stepExecution) {
+		// The filters on actions apply once the step is known, see handle
+		return nil, nil
+	}
+
+	if forwardsActionKind(stepExecution) {
+		tenant := tenantOf(event).TenantName()
 		props := make(map[string]string)
 		addBaseProperties(props, event)
 		addStepExecutionProperties(props, &stepExecution)
-		addTargetExecutionProperties(props, event.ExperimentStepTargetExecution)
-
-		return &types.EventIngest{
-			EventType: "CUSTOM_INFO",
-			Title: fmt.Sprintf("Steadybit experiment '%s / %g' - Attack '%s' ended - Target '%s'",
-				event.ExperimentStepTargetExecution.ExperimentKey,
-				event.ExperimentStepTargetExecution.ExecutionId,
-				getActionName(stepExecution),
-				getTargetName(*event.ExperimentStepTargetExecution)),
+		prefetchEntities(entityCache, tenant, event.ExperimentStepTargetExecution)
+		addTargetExecutionProperties(props, tenant, event.ExperimentStepTargetExecution)
+
+		recordAttackDuration(event, stepExecution, props)
+
+		state := string(event.ExperimentStepTargetExecution.State)
+		opened := config.Config.EventDurations && openEvents.Has(targetDurationKey(event.ExperimentStepTargetExecution))
+		if opened && !isFailedCheck(stepExecution, state) {
+			// The update closing the event opened for the target is sent instead, see closeDurationEvent
+			return nil, nil
+		}
+		defaultType := types.EventTypeCustomInfo
+		if isFailedCheck(stepExecution, state) {
+			defaultType = types.EventTypeError
+		}
+		ingest := &types.EventIngest{
+			EventType:      eventTypeOr(eventTargetCompleted, state, defaultType),
+			Title:          targetTitle(event.ExperimentStepTargetExecution, stepExecution, " ended"),
 			Properties:     props,
-			EntitySelector: getEntitySelector(*event.ExperimentStepTargetExecution),
+			EntitySelector: getEntitySelector(tenant, *event.ExperimentStepTargetExecution, props),
 			StartTime:      new(event.ExperimentStepTargetExecution.EndedTime.UnixMilli()),
 			EndTime:        new(event.ExperimentStepTargetExecution.EndedTime.UnixMilli()),
-		}, nil
+		}
+		if isFailedCheck(stepExecution, state) {
+			addFailure(ingest, event, stepExecution, state)
+		}
+		if config.Config.EventDurations && !opened {
+			// No event was opened, like after a restart, so this event spans the target execution
+			ingest.Title = targetTitle(event.ExperimentStepTargetExecution, stepExecution, "")
+			if event.ExperimentStepTargetExecution.StartedTime != nil {
+				ingest.StartTime = new(event.ExperimentStepTargetExecution.StartedTime.UnixMilli())
+			}
+		}
+		applyEventTemplate(eventTargetCompleted, ingest, event, &stepExecution)
+		return ingest, nil
 	}
 	return nil, nil
 }
 
+// targetTitle returns the title of the events of a target of an attack, check or load test. The suffix tells whether
+// the target started or ended, it's empty for an event spanning the target.
+func targetTitle(target *event_kit_api.ExperimentStepTargetExecution, stepExecution event_kit_api.ExperimentStepExecution, suffix string) string {
+	return fmt.Sprintf("Steadybit experiment '%s / %g' - %s '%s'%s - Target '%s'",
+		target.ExperimentKey,
+		target.ExecutionId,
+		actionKindLabel(stepExecution),
+		getActionName(stepExecution),
+		suffix,
+		getTargetName(*target))
+}
+
 func getActionName(target event_kit_api.ExperimentStepExecution) string {
 	actionName := *target.ActionId
 	if target.ActionName != nil {
@@ -219,49 +426,63 @@ func getTargetName(target event_kit_api.ExperimentStepTargetExecution) string {
 	return target.TargetName
 }
 
-func getEntitySelector(target event_kit_api.ExperimentStepTargetExecution) *string {
-	var entitySelector *string
-
-	if target.TargetType == "com.steadybit.extension_kubernetes.kubernetes-cluster" && hasSingleAttribute(target, "k8s.cluster-name") {
-		entitySelector = new(fmt.Sprintf("type(KUBERNETES_CLUSTER),entityName.equals(%s)", target.TargetAttributes["k8s.cluster-name"][0]))
-	} else if target.TargetType == "com.steadybit.extension_kubernetes.kubernetes-deployment" && hasSingleAttribute(target, "k8s.deployment") {
-		entitySelector = new(fmt.Sprintf("type(CLOUD_APPLICATION),entityName.equals(%s)", target.TargetAttributes["k8s.deployment"][0]))
-	} else if target.TargetType == "com.steadybit.extension_kubernetes.kubernetes-statefulset" && hasSingleAttribute(target, "k8s.statefulset") {
-		entitySelector = new(fmt.Sprintf("type(CLOUD_APPLICATION),entityName.equals(%s)", target.TargetAttributes["k8s.statefulset"][0]))
-	} else if target.TargetType == "com.steadybit.extension_kubernetes.kubernetes-daemonset" && hasSingleAttribute(target, "k8s.daemonset") {
-		entitySelector = new(fmt.Sprintf("type(CLOUD_APPLICATION),entityName.equals(%s)", target.TargetAttributes["k8s.daemonset"][0]))
-	} else if target.TargetType == "com.steadybit.extension_kubernetes.kubernetes-node" && hasSingleAttribute(target, "k8s.node.name") {
-		entitySelector = new(fmt.Sprintf("type(KUBERNETES_NODE),entityName.equals(%s)", target.TargetAttributes["k8s.node.name"][0]))
-	} else if target.TargetType == "com.steadybit.extension_kubernetes.kubernetes-pod" && hasSingleAttribute(target, "k8s.pod.name") {
-		entitySelector = new(fmt.Sprintf("type(CLOUD_APPLICATION_INSTANCE),entityName.equals(%s)", target.TargetAttributes["k8s.pod.name"][0]))
-	} else if target.TargetType == "com.steadybit.extension_jvm.application" && hasSingleAttribute(target, "k8s.pod.name") {
-		entitySelector = new(fmt.Sprintf("type(CLOUD_APPLICATION_INSTANCE),entityName.equals(%s)", target.TargetAttributes["k8s.pod.name"][0]))
-	} else if target.TargetType == "com.steadybit.extension_container.container" && hasSingleAttribute(target, "k8s.container.name") && hasSingleAttribute(target, "k8s.pod.name") {
-		entitySelector = new(fmt.Sprintf("type(CONTAINER_GROUP_INSTANCE),entityName.equals(%s %s)", target.TargetAttributes["k8s.pod.name"][0], target.TargetAttributes["k8s.container.name"][0]))
-	} else if target.TargetType == "com.steadybit.extension_host.host" && hasSingleAttribute(target, "host.hostname") {
-		if hasSingleAttribute(target, "k8s.cluster-name") {
-			entitySelector = new(fmt.Sprintf("type(KUBERNETES_NODE),entityName.equals(%s)", target.TargetAttributes["host.hostname"][0]))
-		} else if hasSingleAttribute(target, "host.hostname") {
-			entitySelector = new(fmt.Sprintf("type(HOST),entityName.equals(%s)", target.TargetAttributes["host.hostname"][0]))
+// getEntitySelector returns the selector of the entity the event is attached to, see config.EntityRules. Selectors
+// matching multiple entities are reported in the properties.
+func getEntitySelector(tenant string, target event_kit_api.ExperimentStepTargetExecution, props map[string]string) *string {
+	for _, entitySelector := range config.EntityRules().EntitySelectors(target.TargetType, target.TargetAttributes, maxEntities()) {
+		// Check if entity exists, don't use selector if not found, dynatrace will not accept it otherwise
+		ids := lookupEntities(tenant, entitySelector)
+		switch {
+		case len(ids) == 0:
+			continue
+		case len(ids) == 1:
+			rememberEntities(target.ExecutionId, ids)
+			return &entitySelector
+		case !config.Config.EventAttachAllEntities:
+			reportEntities(props, "steadybit.entities.ambiguous", entitySelector, len(ids))
+		case len(ids) > maxEntities():
+			reportEntities(props, "steadybit.entities.truncated", entitySelector, len(ids))
+			rememberEntities(target.ExecutionId, ids[:maxEntities()])
+			return new(entityIdSelector(ids[:maxEntities()]))
+		default:
+			rememberEntities(target.ExecutionId, ids)
+			return &entitySelector
 		}
 	}
+	return nil
+}
 
-	// Check if entity exists, don't use selector if not found, dynatrace will not accept it otherwise
-	if entitySelector != nil {
-		entity := entityCache.Get(*entitySelector)
-		if entity == nil || len(entity.Value()) == 0 {
-			return nil
-		}
+// lookupEntities returns the IDs of the entities matching the selector.
+func lookupEntities(tenant string, entitySelector string) []string {
+	entity := entityCache.Get(entityKey{tenant: tenant, selector: entitySelector})
+	if entity == nil {
+		return nil
 	}
+	return entity.Value()
+}
+
+// maxEntities returns the number of entities an event may reference per selector.
+func maxEntities() int {
+	if !config.Config.EventAttachAllEntities {
+		return 1
+	}
+	return config.IntOrDefault(config.Config.EventMaxEntities, 10)
+}
 
-	return entitySelector
+func entityIdSelector(ids []string) string {
+	return fmt.Sprintf(`entityId("%s")`, strings.Join(ids, `","`))
 }
 
-func hasSingleAttribute(target event_kit_api.ExperimentStepTargetExecution, attribute string) bool {
-	if values, ok := target.TargetAttributes[attribute]; ok {
-		return len(values) == 1
+// reportEntities adds a selector that matched more entities than referenced by the event to the property.
+func reportEntities(props map[string]string, property string, entitySelector string, count int) {
+	report := fmt.Sprintf("%s matched %d entities", entitySelector, count)
+	previous, ok := props[property]
+	switch {
+	case !ok:
+		props[property] = report
+	case !slices.Contains(strings.Split(previous, "; "), report):
+		props[property] = previous + "; " + report
 	}
-	return false
 }
 
 func addBaseProperties(props map[string]string, event *event_kit_api.EventRequestBody) {
@@ -316,7 +537,7 @@ func addStepExecutionProperties(props map[string]string, stepExecution *event_ki
 	}
 }
 
-func addTargetExecutionProperties(props map[string]string, targetExecution *event_kit_api.ExperimentStepTargetExecution) {
+func addTargetExecutionProperties(props map[string]string, tenant string, targetExecution *event_kit_api.ExperimentStepTargetExecution) {
 	if targetExecution == nil {
 		return
 	}
@@ -324,26 +545,19 @@ func addTargetExecutionProperties(props map[string]string, targetExecution *even
 	props["steadybit.execution.id"] = fmt.Sprintf("%g", targetExecution.ExecutionId)
 	props["steadybit.execution.target.state"] = string(targetExecution.State)
 
-	addIfPresent(props, *targetExecution, "k8s.cluster-name", "KUBERNETES_CLUSTER", "dt.entity.kubernetes_cluster")
-	addIfPresent(props, *targetExecution, "k8s.namespace", "CLOUD_APPLICATION_NAMESPACE", "dt.entity.cloud_application_namespace")
-	addIfPresent(props, *targetExecution, "k8s.deployment", "CLOUD_APPLICATION", "dt.entity.cloud_application")
-	addIfPresent(props, *targetExecution, "k8s.pod.name", "CLOUD_APPLICATION_INSTANCE", "dt.entity.cloud_application_instance")
-	if _, ok := targetExecution.TargetAttributes["k8s.cluster-name"]; ok {
-		addIfPresent(props, *targetExecution, "container.host", "KUBERNETES_NODE", "dt.entity.kubernetes_node")
-		addIfPresent(props, *targetExecution, "host.hostname", "KUBERNETES_NODE", "dt.entity.kubernetes_node")
-		addIfPresent(props, *targetExecution, "application.hostname", "KUBERNETES_NODE", "dt.entity.kubernetes_node")
-		addIfPresent(props, *targetExecution, "k8s.node.name", "KUBERNETES_NODE", "dt.entity.kubernetes_node")
-	}
-}
-
-func addIfPresent(props map[string]string, target event_kit_api.ExperimentStepTargetExecution, steadybitAttribute string, entityType string, dynatraceProperty string) {
-	if values, ok := target.TargetAttributes[steadybitAttribute]; ok {
-		//We don't want to add one-to-many attributes to dynatrace. For example when attacking a host, we don't want to add all namespaces or pods which are running on that host.
-		if (len(values)) == 1 {
-			entity := entityCache.Get(fmt.Sprintf("type(%s),entityName.equals(%s)", entityType, values[0]))
-			if entity != nil && len(entity.Value()) > 0 {
-				props[dynatraceProperty] = entity.Value()
-			}
+	for _, property := range config.EntityRules().PropertySelectors(targetExecution.TargetType, targetExecution.TargetAttributes, maxEntities()) {
+		ids := lookupEntities(tenant, property.Selector)
+		switch {
+		case len(ids) == 0:
+		case len(ids) == 1:
+			props[property.Property] = ids[0]
+		case !config.Config.EventAttachAllEntities:
+			reportEntities(props, "steadybit.entities.ambiguous", property.Selector, len(ids))
+		case len(ids) > maxEntities():
+			reportEntities(props, "steadybit.entities.truncated", property.Selector, len(ids))
+			props[property.Property] = strings.Join(ids[:maxEntities()], ",")
+		default:
+			props[property.Property] = strings.Join(ids, ",")
 		}
 	}
 }
@@ -354,17 +568,21 @@ func parseBodyToEventRequestBody(body []byte) (event_kit_api.EventRequestBody, e
 	return event, err
 }
 
-func sendDynatraceEvent(api PostEventApi, event *types.EventIngest) {
-	result, response, err := api.PostEvent(context.Background(), *event)
+// errEventRejected is returned if Dynatrace accepted the request but didn't create the event. Sending it again
+// doesn't help.
+var errEventRejected = errors.New("event rejected by Dynatrace")
+
+// sendDynatraceEvent posts the event and returns an error unless Dynatrace created it.
+func sendDynatraceEvent(ctx context.Context, api PostEventApi, event *types.EventIngest) (*types.EventIngestResults, error) {
+	result, response, err := api.PostEvent(ctx, *event)
 
 	if err != nil {
-		log.Err(err).Msgf("Failed to send Dynatrace event. Full response %v", response)
+		return nil, err
 	} else if response.StatusCode != 201 {
-		log.Error().Msgf("Dynatrace API responded with unexpected status code %d while sending Event. Full response: %v",
-			response.StatusCode, response)
-	} else if result != nil && result.ReportCount > 0 {
-		log.Debug().Msgf("Successfully sent Dynatrace event. Response: %v", result)
-	} else {
-		log.Warn().Msgf("No Dynatrace event was created. Response: %v", result)
+		return nil, fmt.Errorf("%w: unexpected status code %d", errEventRejected, response.StatusCode)
+	} else if result == nil || result.ReportCount == 0 {
+		return nil, fmt.Errorf("%w: no event was created, response: %v", errEventRejected, result)
 	}
+	log.Debug().Msgf("Successfully sent Dynatrace event. Response: %v", result)
+	return result, nil
 }
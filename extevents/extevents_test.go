@@ -11,6 +11,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jellydator/ttlcache/v3"
 	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
 	"github.com/steadybit/extension-dynatrace/types"
 	"github.com/steadybit/extension-kit/extutil"
 	"github.com/stretchr/testify/assert"
@@ -257,14 +258,14 @@ func hash(s string) string {
 }
 
 func Test_addTargetExecutionProperties(t *testing.T) {
-	mockLoader := ttlcache.LoaderFunc[string, string](
-		func(c *ttlcache.Cache[string, string], key string) *ttlcache.Item[string, string] {
-			return c.Set(key, hash(key), ttlcache.DefaultTTL)
+	mockLoader := ttlcache.LoaderFunc[entityKey, []string](
+		func(c *ttlcache.Cache[entityKey, []string], key entityKey) *ttlcache.Item[entityKey, []string] {
+			return c.Set(key, []string{hash(key.selector)}, ttlcache.DefaultTTL)
 		},
 	)
-	entityCache = ttlcache.New[string, string](
-		ttlcache.WithLoader[string, string](mockLoader),
-		ttlcache.WithTTL[string, string](30*time.Minute),
+	entityCache = ttlcache.New[entityKey, []string](
+		ttlcache.WithLoader[entityKey, []string](mockLoader),
+		ttlcache.WithTTL[entityKey, []string](30*time.Minute),
 	)
 
 	type args struct {
@@ -348,7 +349,7 @@ func Test_addTargetExecutionProperties(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			props := make(map[string]string)
-			addTargetExecutionProperties(props, &tt.args.target)
+			addTargetExecutionProperties(props, "", &tt.args.target)
 			assert.Equalf(t, tt.want, props, "addTargetExecutionProperties(%v)", tt.args.target)
 		})
 	}
@@ -446,3 +447,63 @@ func Test_onExperimentStepStarted(t *testing.T) {
 		})
 	}
 }
+
+func mockEntities(t *testing.T, entities map[string][]string) {
+	previous := entityCache
+	t.Cleanup(func() { entityCache = previous })
+	entityCache = ttlcache.New[entityKey, []string](
+		ttlcache.WithLoader[entityKey, []string](ttlcache.LoaderFunc[entityKey, []string](
+			func(c *ttlcache.Cache[entityKey, []string], key entityKey) *ttlcache.Item[entityKey, []string] {
+				return c.Set(key, entities[key.selector], ttlcache.DefaultTTL)
+			},
+		)),
+	)
+}
+
+func Test_getEntitySelector_ReportsAmbiguousEntities(t *testing.T) {
+	mockEntities(t, map[string][]string{
+		"type(KUBERNETES_NODE),entityName.equals(node-1)": {"KUBERNETES_NODE-1", "KUBERNETES_NODE-2"},
+		"type(HOST),entityName.equals(node-1)":            {"HOST-1"},
+	})
+	target := event_kit_api.ExperimentStepTargetExecution{
+		TargetType:       "com.steadybit.extension_host.host",
+		TargetAttributes: map[string][]string{"host.hostname": {"node-1"}, "k8s.cluster-name": {"prod"}},
+	}
+	props := make(map[string]string)
+
+	got := getEntitySelector("", target, props)
+
+	assert.Equal(t, new("type(HOST),entityName.equals(node-1)"), got)
+	assert.Equal(t, "type(KUBERNETES_NODE),entityName.equals(node-1) matched 2 entities", props["steadybit.entities.ambiguous"])
+}
+
+func Test_getEntitySelector_AttachesAllEntities(t *testing.T) {
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventAttachAllEntities = true
+	config.Config.EventMaxEntities = 2
+	mockEntities(t, map[string][]string{
+		"type(CLOUD_APPLICATION),entityName.equals(checkout)":                   {"CLOUD_APPLICATION-1", "CLOUD_APPLICATION-2"},
+		`type(KUBERNETES_CLUSTER),entityName.in("prod","staging")`:              {"KUBERNETES_CLUSTER-1", "KUBERNETES_CLUSTER-2", "KUBERNETES_CLUSTER-3"},
+		"type(CLOUD_APPLICATION_NAMESPACE),entityName.equals(shop)":             {"CLOUD_APPLICATION_NAMESPACE-1"},
+		`type(CLOUD_APPLICATION_NAMESPACE),entityName.in("shop","shop-canary")`: {"CLOUD_APPLICATION_NAMESPACE-1", "CLOUD_APPLICATION_NAMESPACE-2"},
+	})
+
+	deployment := event_kit_api.ExperimentStepTargetExecution{
+		TargetType:       "com.steadybit.extension_kubernetes.kubernetes-deployment",
+		TargetAttributes: map[string][]string{"k8s.deployment": {"checkout"}},
+	}
+	props := make(map[string]string)
+	assert.Equal(t, new("type(CLOUD_APPLICATION),entityName.equals(checkout)"), getEntitySelector("", deployment, props))
+	assert.Empty(t, props)
+
+	cluster := event_kit_api.ExperimentStepTargetExecution{
+		TargetType:       "com.steadybit.extension_kubernetes.kubernetes-cluster",
+		TargetAttributes: map[string][]string{"k8s.cluster-name": {"prod", "staging"}, "k8s.namespace": {"shop", "shop-canary"}},
+	}
+	assert.Equal(t, new(`entityId("KUBERNETES_CLUSTER-1","KUBERNETES_CLUSTER-2")`), getEntitySelector("", cluster, props))
+	addTargetExecutionProperties(props, "", &cluster)
+	assert.Equal(t, "KUBERNETES_CLUSTER-1,KUBERNETES_CLUSTER-2", props["dt.entity.kubernetes_cluster"])
+	assert.Equal(t, "CLOUD_APPLICATION_NAMESPACE-1,CLOUD_APPLICATION_NAMESPACE-2", props["dt.entity.cloud_application_namespace"])
+	assert.Equal(t, `type(KUBERNETES_CLUSTER),entityName.in("prod","staging") matched 3 entities`, props["steadybit.entities.truncated"])
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+)
+
+// forwardsEvent applies the event filters, see config.EventFilter. The action of step and target events is taken from
+// their step execution.
+func forwardsEvent(event *event_kit_api.EventRequestBody, step *event_kit_api.ExperimentStepExecution) bool {
+	if len(config.Config.EventAllow) == 0 && len(config.Config.EventDeny) == 0 {
+		return true
+	}
+	scope := eventScope(event)
+	if step == nil {
+		step = event.ExperimentStepExecution
+	}
+	if step != nil && step.ActionId != nil {
+		scope.Action = *step.ActionId
+	}
+	return config.Config.ForwardsEvent(scope)
+}
+
+// forwardsExecution applies the event filters on the execution of the event, without its action. It drops events
+// early, before the step of target events is known, see config.Specification.ForwardsExecution.
+func forwardsExecution(event *event_kit_api.EventRequestBody) bool {
+	if len(config.Config.EventAllow) == 0 && len(config.Config.EventDeny) == 0 {
+		return true
+	}
+	return config.Config.ForwardsExecution(eventScope(event))
+}
+
+// eventScope returns the execution the event belongs to, without the action.
+func eventScope(event *event_kit_api.EventRequestBody) config.EventScope {
+	scope := config.EventScope{PrincipalType: principalType(event.Principal)}
+	if event.Environment != nil {
+		scope.Environment = event.Environment.Name
+	}
+	if event.Team != nil {
+		scope.Team = event.Team.Key
+	}
+	switch {
+	case event.ExperimentExecution != nil:
+		scope.Experiment = event.ExperimentExecution.ExperimentKey
+	case event.ExperimentStepExecution != nil:
+		scope.Experiment = event.ExperimentStepExecution.ExperimentKey
+	case event.ExperimentStepTargetExecution != nil:
+		scope.Experiment = event.ExperimentStepTargetExecution.ExperimentKey
+	}
+	return scope
+}
+
+// principalType returns the type of the principal that started the execution. Decoded from the request body, the
+// principal is a map.
+func principalType(principal any) string {
+	switch p := principal.(type) {
+	case map[string]any:
+		t, _ := p["principalType"].(string)
+		return t
+	case event_kit_api.UserPrincipal:
+		return p.PrincipalType
+	case event_kit_api.AccessTokenPrincipal:
+		return p.PrincipalType
+	case event_kit_api.BatchPrincipal:
+		return p.PrincipalType
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func filterEvents(t *testing.T, allow config.EventFilters, deny config.EventFilters) {
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventAllow = allow
+	config.Config.EventDeny = deny
+}
+
+func Test_handle_DropsFilteredEvents(t *testing.T) {
+	filterEvents(t, nil, config.EventFilters{{PrincipalTypes: []string{"batch"}}})
+	called := false
+	handler := handle(func(*event_kit_api.EventRequestBody) (*types.EventIngest, error) {
+		called = true
+		return nil, nil
+	})
+	recorder := httptest.NewRecorder()
+
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/events/experiment-started", nil),
+		[]byte(`{"environment":{"name":"gateway"},"experimentExecution":{"experimentKey":"KEY"},"principal":{"principalType":"batch","username":"scheduler"}}`))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, called)
+}
+
+func Test_forwardsEvent_UsesActionOfStep(t *testing.T) {
+	filterEvents(t, nil, config.EventFilters{{Actions: []string{"some_*"}}})
+	step, started, _ := attackEvents(time.Now(), time.Now())
+	_, err := onExperimentStepStarted(&step)
+	require.NoError(t, err)
+
+	assert.False(t, forwardsEvent(&started, step.ExperimentStepExecution))
+	assert.True(t, forwardsEvent(&event_kit_api.EventRequestBody{
+		Environment:         step.Environment,
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{ExperimentKey: "KEY"}),
+	}, nil))
+
+	got, err := onExperimentTargetStarted(&started)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func Test_handle_FiltersActionsOfTargetsOnceTheStepIsKnown(t *testing.T) {
+	filterEvents(t, config.EventFilters{{Actions: []string{"other_*"}}}, nil)
+	previousWorkers := workers
+	t.Cleanup(func() { workers = previousWorkers })
+	submitted := make(chan eventJob, 1)
+	workers = newWorkerPool(1, 1, func(job eventJob) { submitted <- job })
+	step, started, _ := attackEvents(time.Now(), time.Now())
+	body, err := json.Marshal(started)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+
+	// The step of the target isn't known yet, so the rule on actions can't apply
+	handle(onExperimentTargetStarted)(recorder, httptest.NewRequest(http.MethodPost, "/events/experiment-target-started", nil), body)
+	workers.stop()
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	require.Len(t, submitted, 1)
+	job := <-submitted
+	_, err = onExperimentStepStarted(&step)
+	require.NoError(t, err)
+	got, err := job.handler(&job.event)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func Test_principalType(t *testing.T) {
+	assert.Equal(t, "batch", principalType(map[string]any{"principalType": "batch"}))
+	assert.Equal(t, "user", principalType(event_kit_api.UserPrincipal{PrincipalType: "user"}))
+	assert.Equal(t, "", principalType(nil))
+}
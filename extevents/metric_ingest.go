@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-kit/extsignals"
+)
+
+// MetricScopes are the scopes the Dynatrace API token needs to write metrics about the experiments
+var MetricScopes = []string{config.ScopeMetricsIngest}
+
+// Keys of the metrics written to Dynatrace
+const (
+	metricExperimentExecutions = "steadybit.experiment.executions"
+	metricExperimentTargets    = "steadybit.experiment.attacked_targets"
+	metricAttackDuration       = "steadybit.attack.duration"
+)
+
+const (
+	// maxMetricLinesPerRequest is the maximum number of lines Dynatrace accepts per request
+	maxMetricLinesPerRequest = 1000
+	// maxBufferedMetricLines limits the lines kept per tenant while Dynatrace isn't reachable, the oldest are dropped
+	maxBufferedMetricLines = 10000
+)
+
+// metricIngestEnabled is set if metrics are written, see config.Specification.MetricIngest
+var metricIngestEnabled atomic.Bool
+
+// metricBuffer collects the metric lines per tenant until they are sent to Dynatrace.
+type metricBuffer struct {
+	mu    sync.Mutex
+	lines map[string][]string
+}
+
+var metricLines = &metricBuffer{lines: map[string][]string{}}
+
+func (b *metricBuffer) add(tenant string, lines ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	buffered := append(b.lines[tenant], lines...)
+	if dropped := len(buffered) - maxBufferedMetricLines; dropped > 0 {
+		log.Warn().Str("tenant", tenant).Int("lines", dropped).Msg("Dropping metric lines exceeding the buffer.")
+		buffered = buffered[dropped:]
+	}
+	b.lines[tenant] = buffered
+}
+
+func (b *metricBuffer) take() map[string][]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := b.lines
+	b.lines = map[string][]string{}
+	return lines
+}
+
+// startMetricIngest sends the collected metrics in the configured interval and on SIGTERM.
+func startMetricIngest() {
+	if !config.Config.MetricIngest || !config.HasScopes("Writing experiment metrics", MetricScopes...) {
+		return
+	}
+	metricIngestEnabled.Store(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(config.DurationOrDefault(config.Config.MetricIngestInterval, 30*time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				flushMetrics(ctx)
+			}
+		}
+	}()
+	extsignals.AddSignalHandler(extsignals.SignalHandler{
+		Handler: func(_ os.Signal) {
+			cancel()
+			<-done
+			flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer flushCancel()
+			flushMetrics(flushCtx)
+		},
+		Order: extsignals.OrderStopCustom,
+		Name:  "FlushMetrics",
+	})
+}
+
+// flushMetrics sends the collected metrics. Lines of failed requests are kept for the next attempt, unless Dynatrace
+// rejected them.
+func flushMetrics(ctx context.Context) {
+	for tenant, lines := range metricLines.take() {
+		spec, err := config.ForTenant(tenant)
+		if err != nil {
+			log.Error().Err(err).Msg("Dropping metrics of unknown tenant.")
+			continue
+		}
+		for chunk := range slices.Chunk(lines, maxMetricLinesPerRequest) {
+			result, response, err := spec.IngestMetrics(ctx, chunk)
+			switch {
+			case response != nil && response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != 429:
+				log.Error().Err(err).Str("tenant", tenant).Int("lines", len(chunk)).Msg("Dynatrace rejected metrics.")
+			case err != nil:
+				log.Warn().Err(err).Str("tenant", tenant).Int("lines", len(chunk)).Msg("Failed to send metrics, retrying with the next interval.")
+				metricLines.add(tenant, chunk...)
+			case result != nil && result.LinesInvalid > 0:
+				log.Warn().Str("tenant", tenant).Int("linesInvalid", result.LinesInvalid).Interface("error", result.Error).Msg("Dynatrace rejected some metric lines.")
+			}
+		}
+	}
+}
+
+// metricLine formats a metric in the line protocol, like 'steadybit.attack.duration,action_id="stop" gauge,12.5 1609459260000'.
+// Dimensions without value are left out.
+func metricLine(key string, dimensions map[string]string, payload string, timestamp time.Time) string {
+	var line strings.Builder
+	line.WriteString(key)
+	for _, name := range slices.Sorted(maps.Keys(dimensions)) {
+		if value := dimensions[name]; value != "" {
+			line.WriteString("," + name + "=" + quoteDimension(value))
+		}
+	}
+	line.WriteString(" " + payload + " " + strconv.FormatInt(timestamp.UnixMilli(), 10))
+	return line.String()
+}
+
+// quoteDimension quotes a dimension value, escaping quotes and backslashes. Line breaks would end the line.
+func quoteDimension(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ", "\r", " ").Replace(value) + `"`
+}
+
+// metricDimensions returns the dimensions of all metrics of the execution.
+func metricDimensions(event *event_kit_api.EventRequestBody, experimentKey string) map[string]string {
+	dimensions := map[string]string{"experiment_key": experimentKey}
+	if event.Environment != nil {
+		dimensions["environment"] = event.Environment.Name
+	}
+	if event.Team != nil {
+		dimensions["team"] = event.Team.Key
+	}
+	return dimensions
+}
+
+// targetSet holds the distinct targets attacked by an experiment execution
+type targetSet struct {
+	mutex   sync.Mutex
+	targets map[uuid.UUID]struct{}
+}
+
+// attackedTargets by experiment execution ID, until the experiment ends or the state TTL expires
+var attackedTargets = ttlcache.New[float32, *targetSet](ttlcache.WithDisableTouchOnHit[float32, *targetSet]())
+
+// countAttackedTarget counts the target of an attack, if the metrics or the business events report the targets.
+func countAttackedTarget(target *event_kit_api.ExperimentStepTargetExecution, step event_kit_api.ExperimentStepExecution) {
+	if (!metricIngestEnabled.Load() && !sendsBizEvents()) || step.ActionKind == nil || *step.ActionKind != event_kit_api.Attack {
+		return
+	}
+	item, _ := attackedTargets.GetOrSet(target.ExecutionId, &targetSet{targets: map[uuid.UUID]struct{}{}}, ttlcache.WithTTL[float32, *targetSet](executionStateTtl()))
+	set := item.Value()
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	set.targets[target.Id] = struct{}{}
+}
+
+// attackedTargetCount returns the number of targets the execution attacked so far.
+func attackedTargetCount(executionId float32) int {
+	item := attackedTargets.Get(executionId)
+	if item == nil {
+		return 0
+	}
+	set := item.Value()
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	return len(set.targets)
+}
+
+// takeAttackedTargets returns the number of targets the execution attacked and forgets them.
+func takeAttackedTargets(executionId float32) int {
+	item, ok := attackedTargets.GetAndDelete(executionId)
+	if !ok {
+		return 0
+	}
+	set := item.Value()
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	return len(set.targets)
+}
+
+// recordExperimentMetrics counts the ended execution by state and records the number of targets it attacked.
+func recordExperimentMetrics(event *event_kit_api.EventRequestBody, targets int) {
+	if !metricIngestEnabled.Load() {
+		return
+	}
+
+	execution := event.ExperimentExecution
+	timestamp := event.EventTime
+	if execution.EndedTime != nil {
+		timestamp = *execution.EndedTime
+	}
+	dimensions := metricDimensions(event, execution.ExperimentKey)
+	targetsLine := metricLine(metricExperimentTargets, dimensions, fmt.Sprintf("gauge,%d", targets), timestamp)
+	dimensions["state"] = string(execution.State)
+	metricLines.add(tenantOf(event).TenantName(),
+		metricLine(metricExperimentExecutions, dimensions, "count,delta=1", timestamp),
+		targetsLine)
+}
+
+// recordAttackDuration records the duration of the attack on the target, with the entities of the target as
+// dimensions. Properties referencing several entities are left out.
+func recordAttackDuration(event *event_kit_api.EventRequestBody, step event_kit_api.ExperimentStepExecution, props map[string]string) {
+	target := event.ExperimentStepTargetExecution
+	if !metricIngestEnabled.Load() || step.ActionKind == nil || *step.ActionKind != event_kit_api.Attack ||
+		step.ActionId == nil || target.StartedTime == nil || target.EndedTime == nil {
+		return
+	}
+	dimensions := metricDimensions(event, target.ExperimentKey)
+	dimensions["action_id"] = *step.ActionId
+	for key, value := range props {
+		if strings.HasPrefix(key, "dt.entity.") && !strings.Contains(value, ",") {
+			dimensions[key] = value
+		}
+	}
+	seconds := target.EndedTime.Sub(*target.StartedTime).Seconds()
+	metricLines.add(tenantOf(event).TenantName(),
+		metricLine(metricAttackDuration, dimensions, "gauge,"+strconv.FormatFloat(seconds, 'f', -1, 64), *target.EndedTime))
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func enableMetricIngest(t *testing.T) {
+	metricIngestEnabled.Store(true)
+	metricLines.take()
+	t.Cleanup(func() {
+		metricIngestEnabled.Store(false)
+		metricLines.take()
+	})
+}
+
+func Test_metricLine(t *testing.T) {
+	timestamp := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+
+	got := metricLine("steadybit.attack.duration", map[string]string{"team": "", "environment": `Prod "EU"`, "action_id": `a\b`}, "gauge,12.5", timestamp)
+
+	assert.Equal(t, `steadybit.attack.duration,action_id="a\\b",environment="Prod \"EU\"" gauge,12.5 1609459260000`, got)
+}
+
+func Test_recordExperimentMetrics(t *testing.T) {
+	enableMetricIngest(t)
+	step := event_kit_api.ExperimentStepExecution{ActionKind: extutil.Ptr(event_kit_api.Attack)}
+	check := event_kit_api.ExperimentStepExecution{ActionKind: extutil.Ptr(event_kit_api.Check)}
+	first := event_kit_api.ExperimentStepTargetExecution{ExecutionId: 91, Id: uuid.New()}
+	countAttackedTarget(&first, step)
+	countAttackedTarget(&first, step)
+	countAttackedTarget(&event_kit_api.ExperimentStepTargetExecution{ExecutionId: 91, Id: uuid.New()}, step)
+	countAttackedTarget(&event_kit_api.ExperimentStepTargetExecution{ExecutionId: 91, Id: uuid.New()}, check)
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+
+	recordExperimentMetrics(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "Prod"}),
+		Team:                new(event_kit_api.Team{Key: "OPS"}),
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 91, ExperimentKey: "OPS-1", State: event_kit_api.ExperimentExecutionStateFailed, EndedTime: &endedTime}),
+	}, takeAttackedTargets(91))
+
+	assert.Equal(t, []string{
+		`steadybit.experiment.executions,environment="Prod",experiment_key="OPS-1",state="failed",team="OPS" count,delta=1 1609459620000`,
+		`steadybit.experiment.attacked_targets,environment="Prod",experiment_key="OPS-1",team="OPS" gauge,2 1609459620000`,
+	}, metricLines.take()[""])
+}
+
+func Test_recordAttackDuration(t *testing.T) {
+	enableMetricIngest(t)
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 2, 30, 0, time.UTC)
+	event := &event_kit_api.EventRequestBody{
+		Environment:                   new(event_kit_api.Environment{Name: "Prod"}),
+		ExperimentStepTargetExecution: new(event_kit_api.ExperimentStepTargetExecution{ExperimentKey: "OPS-1", StartedTime: &startedTime, EndedTime: &endedTime}),
+	}
+	step := event_kit_api.ExperimentStepExecution{ActionKind: extutil.Ptr(event_kit_api.Attack), ActionId: new("com.steadybit.extension_container.stop")}
+
+	recordAttackDuration(event, step, map[string]string{
+		"dt.entity.service":            "SERVICE-1",
+		"dt.entity.kubernetes_cluster": "KUBERNETES_CLUSTER-1,KUBERNETES_CLUSTER-2",
+		"steadybit.step.action.id":     "com.steadybit.extension_container.stop",
+	})
+
+	assert.Equal(t, []string{
+		`steadybit.attack.duration,action_id="com.steadybit.extension_container.stop",dt.entity.service="SERVICE-1",environment="Prod",experiment_key="OPS-1" gauge,90 1609459350000`,
+	}, metricLines.take()[""])
+}
+
+func Test_recordMetrics_Disabled(t *testing.T) {
+	metricLines.take()
+	endedTime := time.Date(2021, 1, 1, 0, 7, 0, 0, time.UTC)
+
+	recordExperimentMetrics(&event_kit_api.EventRequestBody{ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 92, EndedTime: &endedTime})}, 1)
+
+	assert.Empty(t, metricLines.take())
+}
+
+func Test_flushMetrics_KeepsLinesOfFailedRequests(t *testing.T) {
+	enableMetricIngest(t)
+	var mu sync.Mutex
+	var bodies []string
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "/v2/metrics/ingest", r.URL.Path)
+		assert.Equal(t, "text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"linesOk":2,"linesInvalid":0}`))
+	}))
+	t.Cleanup(server.Close)
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config = config.Specification{ApiBaseUrl: server.URL, ApiToken: "token"}
+	metricLines.add("", "a gauge,1", "b gauge,2")
+
+	flushMetrics(context.Background())
+	require.Len(t, metricLines.lines[""], 2)
+
+	mu.Lock()
+	status = http.StatusAccepted
+	mu.Unlock()
+	flushMetrics(context.Background())
+
+	assert.Empty(t, metricLines.take())
+	assert.Equal(t, "a gauge,1\nb gauge,2", bodies[len(bodies)-1])
+	assert.Equal(t, bodies[0], bodies[1])
+}
+
+func Test_metricBuffer_DropsOldestLines(t *testing.T) {
+	buffer := &metricBuffer{lines: map[string][]string{}}
+	for i := range maxBufferedMetricLines + 2 {
+		buffer.add("", strings.Repeat("x", i%3))
+	}
+
+	lines := buffer.take()[""]
+
+	assert.Len(t, lines, maxBufferedMetricLines)
+	assert.Equal(t, "xx", lines[0])
+}
+
+func Test_countAttackedTarget_ExpiresWithStateTtl(t *testing.T) {
+	enableMetricIngest(t)
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventStateTtl = time.Hour
+	countAttackedTarget(&event_kit_api.ExperimentStepTargetExecution{ExecutionId: 92, Id: uuid.New()}, event_kit_api.ExperimentStepExecution{ActionKind: extutil.Ptr(event_kit_api.Attack)})
+
+	item := attackedTargets.Get(92)
+	require.NotNil(t, item)
+	assert.Equal(t, time.Hour, item.TTL())
+	assert.Equal(t, 1, takeAttackedTargets(92))
+	assert.Equal(t, 0, takeAttackedTargets(92))
+}
+
+func Test_countAttackedTarget_OnlyIfReported(t *testing.T) {
+	countAttackedTarget(&event_kit_api.ExperimentStepTargetExecution{ExecutionId: 93, Id: uuid.New()}, event_kit_api.ExperimentStepExecution{ActionKind: extutil.Ptr(event_kit_api.Attack)})
+
+	assert.Equal(t, 0, attackedTargetCount(93))
+}
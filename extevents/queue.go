@@ -0,0 +1,406 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/extmetrics"
+	"github.com/steadybit/extension-dynatrace/types"
+	"github.com/steadybit/extension-kit/extsignals"
+)
+
+// queuedEvent is an event waiting for delivery to Dynatrace. It is persisted as JSON if the queue has a directory.
+// Events with the same key are delivered in order. If BizEvent is set, it is sent instead of Event.
+type queuedEvent struct {
+	Id          string            `json:"id"`
+	Tenant      string            `json:"tenant"`
+	Key         string            `json:"key"`
+	Path        string            `json:"path"`
+	Event       types.EventIngest `json:"event"`
+	BizEvent    *types.BizEvent   `json:"bizEvent,omitempty"`
+	Enqueued    time.Time         `json:"enqueued"`
+	Attempts    int               `json:"attempts"`
+	NextAttempt time.Time         `json:"nextAttempt"`
+
+	inFlight bool
+}
+
+type deliverFunc func(ctx context.Context, item *queuedEvent) error
+
+// eventQueue delivers events to Dynatrace in the background. Failed deliveries are retried with an exponential
+// backoff until they succeed, fail permanently, or exceed the maximum attempts or age. Dropped events are logged with
+// their full content (dead letter). With a directory, pending events survive restarts.
+//
+// Each tenant has at most one delivery in flight, so a tenant that is slow or down doesn't hold back the others.
+type eventQueue struct {
+	mutex    sync.Mutex
+	items    []*queuedEvent
+	wakeup   chan struct{}
+	spec     *config.Specification
+	deliver  deliverFunc
+	cancel   context.CancelFunc
+	done     chan struct{}
+	flushing bool
+}
+
+var queue *eventQueue
+
+func newEventQueue(spec *config.Specification, deliver deliverFunc) *eventQueue {
+	return &eventQueue{
+		wakeup:  make(chan struct{}, 1),
+		spec:    spec,
+		deliver: deliver,
+	}
+}
+
+// startEventQueue loads the persisted events, starts the delivery and flushes the queue on SIGTERM, after the workers
+// processed their backlog.
+func startEventQueue() {
+	queue = newEventQueue(&config.Config, deliverToDynatrace)
+	queue.load()
+	queue.start()
+	extsignals.AddSignalHandler(extsignals.SignalHandler{
+		Handler: func(_ os.Signal) {
+			if workers != nil {
+				workers.stop()
+			}
+			queue.flush(config.DurationOrDefault(config.Config.EventQueueFlushTimeout, 20*time.Second))
+		},
+		Order: extsignals.OrderStopCustom,
+		Name:  "FlushEventQueue",
+	})
+}
+
+func deliverToDynatrace(ctx context.Context, item *queuedEvent) error {
+	spec, err := config.ForTenant(item.Tenant)
+	if err != nil {
+		return err
+	}
+	if item.BizEvent != nil {
+		_, err := spec.IngestBizEvent(ctx, *item.BizEvent)
+		return err
+	}
+	_, err = sendDynatraceEvent(ctx, spec, &item.Event)
+	return err
+}
+
+// enqueue adds an event for delivery. It returns false if the queue is full and the event was dropped.
+func (q *eventQueue) enqueue(tenant string, key string, path string, event *types.EventIngest) bool {
+	return q.add(&queuedEvent{
+		Id:       uuid.NewString(),
+		Tenant:   tenant,
+		Key:      key,
+		Path:     path,
+		Event:    *event,
+		Enqueued: time.Now(),
+	})
+}
+
+// enqueueBizEvent adds a business event for delivery, see enqueue.
+func (q *eventQueue) enqueueBizEvent(tenant string, key string, path string, event *types.BizEvent) bool {
+	return q.add(&queuedEvent{
+		Id:       uuid.NewString(),
+		Tenant:   tenant,
+		Key:      key,
+		Path:     path,
+		BizEvent: event,
+		Enqueued: time.Now(),
+	})
+}
+
+func (q *eventQueue) add(item *queuedEvent) bool {
+	q.mutex.Lock()
+	if len(q.items) >= config.IntOrDefault(q.spec.EventQueueSize, 1000) {
+		q.mutex.Unlock()
+		q.deadLetter(item, errors.New("event queue is full"))
+		return false
+	}
+	q.items = append(q.items, item)
+	q.mutex.Unlock()
+	q.persist(item)
+	q.notify()
+	return true
+}
+
+func (q *eventQueue) notify() {
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (q *eventQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items)
+}
+
+func (q *eventQueue) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	q.done = make(chan struct{})
+	go func() {
+		defer close(q.done)
+		q.run(ctx)
+	}()
+}
+
+// stop ends the background delivery and waits for the delivery in flight.
+func (q *eventQueue) stop() {
+	if q.cancel != nil {
+		q.cancel()
+		<-q.done
+		q.cancel = nil
+	}
+}
+
+func (q *eventQueue) run(ctx context.Context) {
+	var deliveries sync.WaitGroup
+	defer deliveries.Wait()
+	for {
+		item, wait := q.next(time.Now())
+		if item != nil {
+			deliveries.Go(func() {
+				q.attempt(ctx, item)
+				q.notify()
+			})
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-q.wakeup:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// next returns the first event due for delivery, or the time until the next one is due. An event isn't due while an
+// earlier event with the same key is pending, or while an event of the same tenant is in flight.
+func (q *eventQueue) next(now time.Time) (*queuedEvent, time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	wait := time.Minute
+	busy := make(map[string]bool)
+	for _, item := range q.items {
+		if item.inFlight {
+			busy[item.Tenant] = true
+		}
+	}
+	blocked := make(map[string]bool)
+	for _, item := range q.items {
+		if item.Key != "" && blocked[item.Key] {
+			continue
+		}
+		if item.Key != "" {
+			blocked[item.Key] = true
+		}
+		if busy[item.Tenant] {
+			continue
+		}
+		if !item.NextAttempt.After(now) {
+			item.inFlight = true
+			return item, 0
+		}
+		wait = min(wait, item.NextAttempt.Sub(now))
+	}
+	return nil, wait
+}
+
+// attempt delivers the event once and removes it from the queue unless it is retried later.
+func (q *eventQueue) attempt(ctx context.Context, item *queuedEvent) {
+	err := q.deliver(ctx, item)
+	q.mutex.Lock()
+	item.Attempts++
+	q.mutex.Unlock()
+
+	switch {
+	case err == nil:
+		extmetrics.EventsForwarded.WithLabelValues(item.Path, "success").Inc()
+		q.remove(item)
+	case ctx.Err() != nil:
+		// The queue is stopping, the event is delivered by the flush or after the restart
+		q.mutex.Lock()
+		item.inFlight = false
+		item.Attempts--
+		q.mutex.Unlock()
+	case config.IsPermanent(err) || errors.Is(err, errEventRejected) || item.Attempts >= config.IntOrDefault(q.spec.EventQueueMaxAttempts, 10) ||
+		time.Since(item.Enqueued) > config.DurationOrDefault(q.spec.EventQueueMaxAge, time.Hour):
+		q.remove(item)
+		q.deadLetter(item, err)
+	default:
+		q.mutex.Lock()
+		item.NextAttempt = time.Now().Add(q.backoff(item.Attempts))
+		// During the flush, the event is retried after the restart and holds back the other events of the tenant
+		item.inFlight = q.flushing
+		q.mutex.Unlock()
+		q.persist(item)
+		log.Warn().Err(err).Str("tenant", item.Tenant).Int("attempts", item.Attempts).Time("nextAttempt", item.NextAttempt).Msg("Failed to deliver event to Dynatrace, retrying.")
+	}
+}
+
+func (q *eventQueue) backoff(attempts int) time.Duration {
+	maxBackoff := config.DurationOrDefault(q.spec.EventQueueMaxBackoff, time.Minute)
+	wait := config.DurationOrDefault(q.spec.EventQueueInitialBackoff, time.Second)
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+func (q *eventQueue) remove(item *queuedEvent) {
+	q.mutex.Lock()
+	q.items = slices.DeleteFunc(q.items, func(other *queuedEvent) bool { return other == item })
+	q.mutex.Unlock()
+	if q.spec.EventQueueDir != "" {
+		if err := os.Remove(q.file(item)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Err(err).Str("id", item.Id).Msg("Failed to remove delivered event from disk.")
+		}
+	}
+}
+
+// deadLetter logs an event that is not delivered, including its content, so it can be recovered manually.
+func (q *eventQueue) deadLetter(item *queuedEvent, err error) {
+	extmetrics.EventsForwarded.WithLabelValues(item.Path, "failure").Inc()
+	var event []byte
+	if item.BizEvent != nil {
+		event, _ = json.Marshal(item.BizEvent)
+	} else {
+		event, _ = json.Marshal(item.Event)
+	}
+	log.Error().Err(err).Str("tenant", item.Tenant).Str("path", item.Path).Int("attempts", item.Attempts).RawJSON("event", event).Msg("Dropping event that couldn't be delivered to Dynatrace.")
+}
+
+// flush stops the background delivery and tries to deliver all pending events once, ignoring their backoff. Once a
+// delivery of a tenant fails, its other events aren't tried either. Events still pending at the timeout stay on disk,
+// or are dropped if the queue has no directory.
+func (q *eventQueue) flush(timeout time.Duration) {
+	q.stop()
+	pending := q.len()
+	if pending == 0 {
+		return
+	}
+	log.Info().Int("events", pending).Msg("Delivering pending events to Dynatrace before shutdown.")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	q.mutex.Lock()
+	q.flushing = true
+	q.mutex.Unlock()
+	var deliveries sync.WaitGroup
+	var active atomic.Int32
+	for ctx.Err() == nil {
+		// Read before next, so no delivery can unblock an event after next missed it
+		delivering := active.Load()
+		item, _ := q.next(time.Now().Add(config.DurationOrDefault(q.spec.EventQueueMaxBackoff, time.Minute)))
+		if item != nil {
+			active.Add(1)
+			deliveries.Go(func() {
+				q.attempt(ctx, item)
+				active.Add(-1)
+				q.notify()
+			})
+			continue
+		}
+		if delivering == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-q.wakeup:
+		}
+	}
+	deliveries.Wait()
+	q.mutex.Lock()
+	q.flushing = false
+	remaining := slices.Clone(q.items)
+	q.mutex.Unlock()
+	for _, item := range remaining {
+		item.inFlight = false
+		if q.spec.EventQueueDir == "" {
+			q.deadLetter(item, errors.New("shutting down"))
+		}
+	}
+	if q.spec.EventQueueDir != "" && len(remaining) > 0 {
+		log.Warn().Int("events", len(remaining)).Str("dir", q.spec.EventQueueDir).Msg("Events not delivered before shutdown are kept on disk.")
+	}
+}
+
+func (q *eventQueue) file(item *queuedEvent) string {
+	return filepath.Join(q.spec.EventQueueDir, item.Id+".json")
+}
+
+// persist writes the event to the queue directory, replacing the previous state atomically.
+func (q *eventQueue) persist(item *queuedEvent) {
+	if q.spec.EventQueueDir == "" {
+		return
+	}
+	q.mutex.Lock()
+	b, err := json.Marshal(item)
+	q.mutex.Unlock()
+	if err == nil {
+		tmp := q.file(item) + ".tmp"
+		if err = os.WriteFile(tmp, b, 0600); err == nil {
+			err = os.Rename(tmp, q.file(item))
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("id", item.Id).Msg("Failed to persist event, it is kept in memory only.")
+	}
+}
+
+// load reads the events persisted by a previous run, oldest first.
+func (q *eventQueue) load() {
+	if q.spec.EventQueueDir == "" {
+		return
+	}
+	if err := os.MkdirAll(q.spec.EventQueueDir, 0700); err != nil {
+		log.Error().Err(err).Str("dir", q.spec.EventQueueDir).Msg("Failed to create event queue directory.")
+		return
+	}
+	entries, err := os.ReadDir(q.spec.EventQueueDir)
+	if err != nil {
+		log.Error().Err(err).Str("dir", q.spec.EventQueueDir).Msg("Failed to read event queue directory.")
+		return
+	}
+	var items []*queuedEvent
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(q.spec.EventQueueDir, entry.Name())
+		b, err := os.ReadFile(path)
+		var item queuedEvent
+		if err == nil {
+			err = json.Unmarshal(b, &item)
+		}
+		if err != nil || item.Id == "" {
+			log.Warn().Err(err).Str("file", path).Msg("Ignoring unreadable event in queue directory.")
+			continue
+		}
+		items = append(items, &item)
+	}
+	slices.SortFunc(items, func(a, b *queuedEvent) int { return a.Enqueued.Compare(b.Enqueued) })
+	q.mutex.Lock()
+	q.items = append(items, q.items...)
+	q.mutex.Unlock()
+	if len(items) > 0 {
+		log.Info().Int("events", len(items)).Msg("Loaded pending events from disk.")
+	}
+}
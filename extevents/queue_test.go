@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type deliveryRecorder struct {
+	mutex     sync.Mutex
+	failures  int
+	err       error
+	attempts  int
+	delivered []string
+}
+
+func (d *deliveryRecorder) deliver(_ context.Context, item *queuedEvent) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.attempts++
+	if d.failures > 0 {
+		d.failures--
+		return d.err
+	}
+	d.delivered = append(d.delivered, item.Event.Title)
+	return nil
+}
+
+func (d *deliveryRecorder) deliveredTitles() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]string(nil), d.delivered...)
+}
+
+func (d *deliveryRecorder) attemptCount() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.attempts
+}
+
+func testQueueSpec() *config.Specification {
+	return &config.Specification{EventQueueSize: 10, EventQueueMaxAttempts: 5, EventQueueInitialBackoff: time.Millisecond, EventQueueMaxBackoff: 5 * time.Millisecond}
+}
+
+func Test_eventQueue_RetriesUntilDelivered(t *testing.T) {
+	recorder := &deliveryRecorder{failures: 2, err: errors.New("connection refused")}
+	q := newEventQueue(testQueueSpec(), recorder.deliver)
+	q.start()
+	defer q.stop()
+
+	require.True(t, q.enqueue("default", "1", "/events/experiment-started", &types.EventIngest{Title: "started"}))
+
+	assert.Eventually(t, func() bool { return q.len() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"started"}, recorder.deliveredTitles())
+	assert.Equal(t, 3, recorder.attemptCount())
+}
+
+func Test_eventQueue_DropsPermanentFailures(t *testing.T) {
+	recorder := &deliveryRecorder{failures: 1, err: &config.ApiError{StatusCode: http.StatusBadRequest, Message: "Invalid entity selector"}}
+	q := newEventQueue(testQueueSpec(), recorder.deliver)
+	q.start()
+	defer q.stop()
+
+	q.enqueue("default", "1", "/events/experiment-started", &types.EventIngest{Title: "started"})
+
+	assert.Eventually(t, func() bool { return q.len() == 0 }, time.Second, time.Millisecond)
+	assert.Empty(t, recorder.deliveredTitles())
+	assert.Equal(t, 1, recorder.attemptCount())
+}
+
+func Test_eventQueue_DropsAfterMaxAttempts(t *testing.T) {
+	recorder := &deliveryRecorder{failures: 100, err: &config.ApiError{StatusCode: http.StatusServiceUnavailable}}
+	q := newEventQueue(testQueueSpec(), recorder.deliver)
+	q.start()
+	defer q.stop()
+
+	q.enqueue("default", "1", "/events/experiment-started", &types.EventIngest{Title: "started"})
+
+	assert.Eventually(t, func() bool { return q.len() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, 5, recorder.attemptCount())
+}
+
+func Test_eventQueue_RejectsWhenFull(t *testing.T) {
+	spec := testQueueSpec()
+	spec.EventQueueSize = 1
+	q := newEventQueue(spec, (&deliveryRecorder{}).deliver)
+
+	assert.True(t, q.enqueue("default", "1", "/events/experiment-started", &types.EventIngest{Title: "first"}))
+	assert.False(t, q.enqueue("default", "1", "/events/experiment-started", &types.EventIngest{Title: "second"}))
+	assert.Equal(t, 1, q.len())
+}
+
+func Test_eventQueue_PersistsPendingEvents(t *testing.T) {
+	spec := testQueueSpec()
+	spec.EventQueueDir = t.TempDir()
+
+	// Given - an event enqueued before a restart
+	q := newEventQueue(spec, (&deliveryRecorder{}).deliver)
+	q.enqueue("staging", "1", "/events/experiment-started", &types.EventIngest{Title: "started"})
+	files, _ := os.ReadDir(spec.EventQueueDir)
+	require.Len(t, files, 1)
+
+	// When - the next run loads and delivers it
+	recorder := &deliveryRecorder{}
+	restarted := newEventQueue(spec, recorder.deliver)
+	restarted.load()
+	require.Equal(t, 1, restarted.len())
+	restarted.start()
+	defer restarted.stop()
+
+	// Then
+	assert.Eventually(t, func() bool { return restarted.len() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"started"}, recorder.deliveredTitles())
+	files, _ = os.ReadDir(spec.EventQueueDir)
+	assert.Empty(t, files)
+}
+
+func Test_eventQueue_FlushIgnoresBackoff(t *testing.T) {
+	spec := testQueueSpec()
+	spec.EventQueueInitialBackoff = time.Hour
+	spec.EventQueueMaxBackoff = time.Hour
+	recorder := &deliveryRecorder{failures: 1, err: errors.New("connection refused")}
+	q := newEventQueue(spec, recorder.deliver)
+	q.start()
+
+	q.enqueue("default", "1", "/events/experiment-completed", &types.EventIngest{Title: "ended"})
+	require.Eventually(t, func() bool { return recorder.attemptCount() == 1 }, time.Second, time.Millisecond)
+
+	q.flush(time.Second)
+
+	assert.Equal(t, 0, q.len())
+	assert.Equal(t, []string{"ended"}, recorder.deliveredTitles())
+}
+
+func Test_eventQueue_KeepsOrderOfRetriedEvents(t *testing.T) {
+	recorder := &deliveryRecorder{failures: 2, err: errors.New("connection refused")}
+	q := newEventQueue(testQueueSpec(), nil)
+	q.deliver = func(ctx context.Context, item *queuedEvent) error {
+		if item.Key == "2" {
+			// Events of other executions are not held back
+			recorder.mutex.Lock()
+			recorder.delivered = append(recorder.delivered, item.Event.Title)
+			recorder.mutex.Unlock()
+			return nil
+		}
+		return recorder.deliver(ctx, item)
+	}
+
+	q.enqueue("default", "1", "/events/experiment-target-started", &types.EventIngest{Title: "attack started"})
+	q.enqueue("default", "1", "/events/experiment-target-completed", &types.EventIngest{Title: "attack ended"})
+	q.enqueue("default", "2", "/events/experiment-started", &types.EventIngest{Title: "other started"})
+	q.start()
+	defer q.stop()
+
+	assert.Eventually(t, func() bool { return q.len() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"other started", "attack started", "attack ended"}, recorder.deliveredTitles())
+}
+
+func Test_eventQueue_SlowTenantDoesNotHoldBackOthers(t *testing.T) {
+	recorder := &deliveryRecorder{}
+	release := make(chan struct{})
+	q := newEventQueue(testQueueSpec(), func(ctx context.Context, item *queuedEvent) error {
+		if item.Tenant == "down" {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return recorder.deliver(ctx, item)
+	})
+	q.start()
+	defer q.stop()
+
+	q.enqueue("down", "1", "/events/experiment-started", &types.EventIngest{Title: "down started"})
+	q.enqueue("down", "2", "/events/experiment-started", &types.EventIngest{Title: "down other started"})
+	q.enqueue("default", "3", "/events/experiment-started", &types.EventIngest{Title: "started"})
+
+	assert.Eventually(t, func() bool { return len(recorder.deliveredTitles()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"started"}, recorder.deliveredTitles())
+	close(release)
+	assert.Eventually(t, func() bool { return q.len() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"started", "down started", "down other started"}, recorder.deliveredTitles())
+}
+
+func Test_eventQueue_FlushSkipsFailingTenant(t *testing.T) {
+	recorder := &deliveryRecorder{}
+	var failed atomic.Int32
+	q := newEventQueue(testQueueSpec(), func(ctx context.Context, item *queuedEvent) error {
+		if item.Tenant == "down" {
+			failed.Add(1)
+			return errors.New("connection refused")
+		}
+		return recorder.deliver(ctx, item)
+	})
+
+	q.enqueue("down", "1", "/events/experiment-completed", &types.EventIngest{Title: "down ended"})
+	q.enqueue("down", "2", "/events/experiment-completed", &types.EventIngest{Title: "down other ended"})
+	q.enqueue("default", "3", "/events/experiment-completed", &types.EventIngest{Title: "ended"})
+	q.flush(time.Second)
+
+	assert.Equal(t, []string{"ended"}, recorder.deliveredTitles())
+	assert.Equal(t, int32(1), failed.Load())
+	assert.Equal(t, 2, q.len())
+	for _, item := range q.items {
+		assert.Equal(t, "down", item.Tenant)
+		assert.False(t, item.inFlight)
+	}
+}
@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// statePersister stores the state of the event listeners outside the process.
+type statePersister interface {
+	// load returns the stored state, or nil if there is none
+	load(ctx context.Context) ([]byte, error)
+	save(ctx context.Context, state []byte) error
+}
+
+// newStatePersister returns the persister for the configured file or ConfigMap, or nil if the state is kept in memory
+// only.
+func newStatePersister(file string, configMap string) (statePersister, error) {
+	switch {
+	case file != "" && configMap != "":
+		return nil, errors.New("either a state file or a ConfigMap may be configured, not both")
+	case file != "":
+		return &filePersister{path: file}, nil
+	case configMap != "":
+		return newConfigMapPersister(configMap)
+	}
+	return nil, nil
+}
+
+type filePersister struct {
+	path string
+}
+
+func (p *filePersister) load(_ context.Context) ([]byte, error) {
+	b, err := os.ReadFile(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// save replaces the file atomically
+func (p *filePersister) save(_ context.Context, state []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, state, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	configMapKey      = "state.json"
+)
+
+// configMapPersister stores the state in a Kubernetes ConfigMap, using the Kubernetes API with the service account of
+// the pod.
+type configMapPersister struct {
+	apiUrl    string
+	namespace string
+	name      string
+	tokenFile string
+	client    *http.Client
+}
+
+// newConfigMapPersister creates a persister for the ConfigMap 'name' or 'namespace/name'. Without namespace, the
+// namespace of the pod is used.
+func newConfigMapPersister(ref string) (*configMapPersister, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("a ConfigMap requires running in Kubernetes")
+	}
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found {
+		name = ref
+		b, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine the namespace of the ConfigMap: %w", err)
+		}
+		namespace = strings.TrimSpace(string(b))
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the Kubernetes CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	return &configMapPersister{
+		apiUrl:    "https://" + net.JoinHostPort(host, port),
+		namespace: namespace,
+		name:      name,
+		tokenFile: filepath.Join(serviceAccountDir, "token"),
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+		},
+	}, nil
+}
+
+type configMap struct {
+	ApiVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   configMapMetadata `json:"metadata"`
+	Data       map[string]string `json:"data"`
+}
+
+type configMapMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+func (p *configMapPersister) collectionUrl() string {
+	return fmt.Sprintf("%s/api/v1/namespaces/%s/configmaps", p.apiUrl, url.PathEscape(p.namespace))
+}
+
+func (p *configMapPersister) load(ctx context.Context) ([]byte, error) {
+	response, err := p.request(ctx, http.MethodGet, p.collectionUrl()+"/"+url.PathEscape(p.name), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, p.unexpected(response)
+	}
+	var cm configMap
+	if err := json.NewDecoder(response.Body).Decode(&cm); err != nil {
+		return nil, err
+	}
+	return []byte(cm.Data[configMapKey]), nil
+}
+
+// save replaces the ConfigMap, or creates it if it doesn't exist yet.
+func (p *configMapPersister) save(ctx context.Context, state []byte) error {
+	body, err := json.Marshal(configMap{
+		ApiVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   configMapMetadata{Name: p.name, Namespace: p.namespace},
+		Data:       map[string]string{configMapKey: string(state)},
+	})
+	if err != nil {
+		return err
+	}
+	response, err := p.request(ctx, http.MethodPut, p.collectionUrl()+"/"+url.PathEscape(p.name), body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		_ = response.Body.Close()
+		if response, err = p.request(ctx, http.MethodPost, p.collectionUrl(), body); err != nil {
+			return err
+		}
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+		return p.unexpected(response)
+	}
+	return nil
+}
+
+func (p *configMapPersister) request(ctx context.Context, method string, url string, body []byte) (*http.Response, error) {
+	// The token is read on each request, Kubernetes rotates it
+	token, err := os.ReadFile(p.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account token: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	return p.client.Do(request)
+}
+
+func (p *configMapPersister) unexpected(response *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("unexpected response from Kubernetes for ConfigMap %s/%s: %d %s", p.namespace, p.name, response.StatusCode, strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newStatePersister(t *testing.T) {
+	persister, err := newStatePersister("", "")
+	assert.NoError(t, err)
+	assert.Nil(t, persister)
+
+	persister, err = newStatePersister("/tmp/steps.json", "")
+	assert.NoError(t, err)
+	assert.Equal(t, &filePersister{path: "/tmp/steps.json"}, persister)
+
+	_, err = newStatePersister("/tmp/steps.json", "steps")
+	assert.Error(t, err)
+}
+
+func Test_filePersister_MissingFile(t *testing.T) {
+	persister := &filePersister{path: filepath.Join(t.TempDir(), "missing.json")}
+
+	state, err := persister.load(context.Background())
+
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+}
+
+// fakeConfigMaps serves a single ConfigMap like the Kubernetes API
+func fakeConfigMaps(t *testing.T) (*configMapPersister, *map[string]string) {
+	var mu sync.Mutex
+	var data *map[string]string
+	stored := new(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		var cm configMap
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/namespaces/steadybit/configmaps/state", "PUT /api/v1/namespaces/steadybit/configmaps/state":
+			if data == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method == http.MethodPut {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&cm))
+				*data = cm.Data
+			}
+		case "POST /api/v1/namespaces/steadybit/configmaps":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&cm))
+			assert.Equal(t, "state", cm.Metadata.Name)
+			data = stored
+			*data = cm.Data
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(configMap{Data: *data})
+	}))
+	t.Cleanup(server.Close)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token\n"), 0600))
+	return &configMapPersister{apiUrl: server.URL, namespace: "steadybit", name: "state", tokenFile: tokenFile, client: server.Client()}, stored
+}
+
+func Test_configMapPersister_CreatesAndUpdates(t *testing.T) {
+	persister, stored := fakeConfigMaps(t)
+	ctx := context.Background()
+
+	state, err := persister.load(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, state)
+
+	require.NoError(t, persister.save(ctx, []byte(`[1]`)))
+	require.NoError(t, persister.save(ctx, []byte(`[2]`)))
+	assert.Equal(t, map[string]string{configMapKey: `[2]`}, *stored)
+
+	state, err = persister.load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, `[2]`, string(state))
+}
+
+func Test_configMapPersister_SaveReportsErrorBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`configmaps "state" is forbidden`))
+	}))
+	t.Cleanup(server.Close)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token"), 0600))
+	persister := &configMapPersister{apiUrl: server.URL, namespace: "steadybit", name: "state", tokenFile: tokenFile, client: server.Client()}
+
+	err := persister.save(context.Background(), []byte(`[1]`))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `403 configmaps "state" is forbidden`)
+}
@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-kit/extsignals"
+)
+
+// persistDelay collects the changes of the step store before it is persisted
+const persistDelay = time.Second
+
+// stepStore remembers the step executions of running experiments, which the target events refer to. Entries expire
+// after the TTL, in case the end of an experiment is never received. With a persister, the store survives restarts.
+type stepStore struct {
+	cache     *ttlcache.Cache[uuid.UUID, event_kit_api.ExperimentStepExecution]
+	persister statePersister
+	changed   chan struct{}
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// persistedStep is the persisted form of a step execution
+type persistedStep struct {
+	Step      event_kit_api.ExperimentStepExecution `json:"step"`
+	ExpiresAt time.Time                             `json:"expiresAt"`
+}
+
+var stepExecutions = newStepStore(24*time.Hour, nil)
+
+func newStepStore(ttl time.Duration, persister statePersister) *stepStore {
+	s := &stepStore{
+		cache: ttlcache.New[uuid.UUID, event_kit_api.ExperimentStepExecution](
+			ttlcache.WithTTL[uuid.UUID, event_kit_api.ExperimentStepExecution](ttl),
+			ttlcache.WithDisableTouchOnHit[uuid.UUID, event_kit_api.ExperimentStepExecution](),
+		),
+		persister: persister,
+		changed:   make(chan struct{}, 1),
+	}
+	s.cache.OnEviction(func(_ context.Context, reason ttlcache.EvictionReason, item *ttlcache.Item[uuid.UUID, event_kit_api.ExperimentStepExecution]) {
+		if reason == ttlcache.EvictionReasonExpired {
+			log.Debug().Str("stepExecutionId", item.Key().String()).Msg("Step execution expired.")
+		}
+		s.notify()
+	})
+	return s
+}
+
+// executionStateTtl is how long the state of a running experiment is kept, in case its end is never received, like
+// when it was filtered or the extension restarted meanwhile.
+func executionStateTtl() time.Duration {
+	return config.DurationOrDefault(config.Config.EventStateTtl, 24*time.Hour)
+}
+
+// startStepStore loads the persisted step executions, starts the expiry and persists the store on SIGTERM.
+func startStepStore() {
+	persister, err := newStatePersister(config.Config.EventStateFile, config.Config.EventStateConfigMap)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set up persisting the step executions, they are kept in memory only.")
+	}
+	stepExecutions = newStepStore(executionStateTtl(), persister)
+	stepExecutions.load()
+	stepExecutions.start()
+	extsignals.AddSignalHandler(extsignals.SignalHandler{
+		Handler: func(_ os.Signal) {
+			stepExecutions.stop()
+		},
+		Order: extsignals.OrderStopCustom,
+		Name:  "PersistStepExecutions",
+	})
+}
+
+func (s *stepStore) store(step event_kit_api.ExperimentStepExecution) {
+	s.cache.Set(step.Id, step, ttlcache.DefaultTTL)
+	s.notify()
+}
+
+func (s *stepStore) get(id uuid.UUID) (event_kit_api.ExperimentStepExecution, bool) {
+	item := s.cache.Get(id)
+	if item == nil {
+		return event_kit_api.ExperimentStepExecution{}, false
+	}
+	return item.Value(), true
+}
+
+// deleteExecution forgets the step executions of an ended experiment execution.
+func (s *stepStore) deleteExecution(executionId float32) {
+	for id, item := range s.cache.Items() {
+		if item.Value().ExecutionId == executionId {
+			log.Debug().Msgf("Delete step execution data for id %.0f", executionId)
+			s.cache.Delete(id)
+		}
+	}
+}
+
+func (s *stepStore) len() int {
+	return s.cache.Len()
+}
+
+func (s *stepStore) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *stepStore) start() {
+	go s.cache.Start()
+	if s.persister == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.changed:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(persistDelay):
+			}
+			s.persist(ctx)
+		}
+	}()
+}
+
+// stop ends the expiry and persists the store a last time.
+func (s *stepStore) stop() {
+	s.cache.Stop()
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+		s.cancel = nil
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.persist(ctx)
+	}
+}
+
+func (s *stepStore) persist(ctx context.Context) {
+	steps := make([]persistedStep, 0, s.cache.Len())
+	for _, item := range s.cache.Items() {
+		if !item.IsExpired() {
+			steps = append(steps, persistedStep{Step: item.Value(), ExpiresAt: item.ExpiresAt()})
+		}
+	}
+	b, err := json.Marshal(steps)
+	if err == nil {
+		err = s.persister.save(ctx, b)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to persist step executions.")
+	}
+}
+
+// load reads the step executions persisted by a previous run. Expired ones are skipped.
+func (s *stepStore) load() {
+	if s.persister == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	b, err := s.persister.load(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load persisted step executions.")
+		return
+	}
+	if len(b) == 0 {
+		return
+	}
+	var steps []persistedStep
+	if err := json.Unmarshal(b, &steps); err != nil {
+		log.Error().Err(err).Msg("Ignoring unreadable persisted step executions.")
+		return
+	}
+	loaded := 0
+	for _, step := range steps {
+		if ttl := time.Until(step.ExpiresAt); ttl > 0 {
+			s.cache.Set(step.Step.Id, step.Step, ttl)
+			loaded++
+		}
+	}
+	if loaded > 0 {
+		log.Info().Int("steps", loaded).Msg("Loaded step executions of running experiments.")
+	}
+}
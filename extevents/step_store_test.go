@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_stepStore_Expires(t *testing.T) {
+	store := newStepStore(50*time.Millisecond, nil)
+	store.start()
+	t.Cleanup(store.stop)
+	id := uuid.New()
+
+	store.store(event_kit_api.ExperimentStepExecution{Id: id, ExecutionId: 1})
+	_, ok := store.get(id)
+	require.True(t, ok)
+
+	assert.Eventually(t, func() bool {
+		_, ok := store.get(id)
+		return !ok && store.len() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_stepStore_DeleteExecution(t *testing.T) {
+	store := newStepStore(time.Hour, nil)
+	first, second, other := uuid.New(), uuid.New(), uuid.New()
+	store.store(event_kit_api.ExperimentStepExecution{Id: first, ExecutionId: 1})
+	store.store(event_kit_api.ExperimentStepExecution{Id: second, ExecutionId: 1})
+	store.store(event_kit_api.ExperimentStepExecution{Id: other, ExecutionId: 2})
+
+	store.deleteExecution(1)
+
+	assert.Equal(t, 1, store.len())
+	_, ok := store.get(other)
+	assert.True(t, ok)
+}
+
+func Test_stepStore_PersistsAcrossRestarts(t *testing.T) {
+	persister := &filePersister{path: filepath.Join(t.TempDir(), "state", "steps.json")}
+	id := uuid.New()
+	store := newStepStore(time.Hour, persister)
+	store.start()
+	store.store(event_kit_api.ExperimentStepExecution{Id: id, ExecutionId: 1, ActionId: new("com.steadybit.extension_container.stop")})
+	store.stop()
+
+	restarted := newStepStore(time.Hour, persister)
+	restarted.load()
+
+	step, ok := restarted.get(id)
+	require.True(t, ok)
+	assert.Equal(t, new("com.steadybit.extension_container.stop"), step.ActionId)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), restarted.cache.Get(id).ExpiresAt(), time.Minute)
+}
+
+func Test_stepStore_SkipsExpiredPersistedSteps(t *testing.T) {
+	persister := &filePersister{path: filepath.Join(t.TempDir(), "steps.json")}
+	require.NoError(t, persister.save(context.Background(), []byte(`[{"step":{"id":"`+uuid.NewString()+`"},"expiresAt":"2020-01-01T00:00:00Z"}]`)))
+	store := newStepStore(time.Hour, persister)
+
+	store.load()
+
+	assert.Equal(t, 0, store.len())
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+)
+
+// forwardsActionKind reports whether events are sent for the step, see config.Specification.EventActionKinds.
+func forwardsActionKind(step event_kit_api.ExperimentStepExecution) bool {
+	kinds := config.Config.EventActionKinds
+	if len(kinds) == 0 {
+		kinds = []string{string(event_kit_api.Attack)}
+	}
+	return step.ActionKind != nil && slices.Contains(kinds, string(*step.ActionKind))
+}
+
+// actionKindLabel names the kind of the action in event titles.
+func actionKindLabel(step event_kit_api.ExperimentStepExecution) string {
+	if step.ActionKind == nil {
+		return "Action"
+	}
+	switch *step.ActionKind {
+	case event_kit_api.Attack:
+		return "Attack"
+	case event_kit_api.Check:
+		return "Check"
+	case event_kit_api.LoadTest:
+		return "Load test"
+	}
+	return "Action"
+}
+
+// isFailedCheck reports whether the step is a check that ended in the given state with a failure. Failed checks are
+// sent as ERROR_EVENT unless another event type is configured.
+func isFailedCheck(step event_kit_api.ExperimentStepExecution, state string) bool {
+	return step.ActionKind != nil && *step.ActionKind == event_kit_api.Check &&
+		(state == string(event_kit_api.ExperimentStepExecutionStateFailed) || state == string(event_kit_api.ExperimentStepExecutionStateErrored))
+}
+
+// addFailure describes why the check failed. The reason is taken from the experiment execution, if the event contains
+// it.
+func addFailure(ingest *types.EventIngest, event *event_kit_api.EventRequestBody, step event_kit_api.ExperimentStepExecution, state string) {
+	description := fmt.Sprintf("%s '%s' %s", actionKindLabel(step), getActionName(step), state)
+	if execution := event.ExperimentExecution; execution != nil && execution.Reason != nil {
+		reason := *execution.Reason
+		if execution.ReasonDetails != nil {
+			reason += " - " + *execution.ReasonDetails
+		}
+		description += ": " + reason
+		ingest.Properties["steadybit.failure.reason"] = reason
+	}
+	ingest.Properties["dt.event.description"] = description
+}
+
+func onExperimentStepCompleted(event *event_kit_api.EventRequestBody) (*types.EventIngest, error) {
+	if event.ExperimentStepExecution == nil {
+		return nil, errors.New("missing ExperimentStepExecution in event")
+	}
+	step := *event.ExperimentStepExecution
+	if !config.Config.EventStepCompleted || step.Type != event_kit_api.Action || !forwardsActionKind(step) || !forwardsEvent(event, &step) {
+		return nil, nil
+	}
+
+	state := string(step.State)
+	props := make(map[string]string)
+	addBaseProperties(props, event)
+	addStepExecutionProperties(props, &step)
+	props["steadybit.experiment.key"] = step.ExperimentKey
+	props["steadybit.execution.id"] = fmt.Sprintf("%g", step.ExecutionId)
+	props["steadybit.step.state"] = state
+
+	endTime := event.EventTime
+	if step.EndedTime != nil {
+		endTime = *step.EndedTime
+	}
+	defaultType := types.EventTypeCustomInfo
+	if isFailedCheck(step, state) {
+		defaultType = types.EventTypeError
+	}
+	ingest := &types.EventIngest{
+		EventType:  eventTypeOr(eventStepCompleted, state, defaultType),
+		Title:      stepTitle(step, " "+strings.ReplaceAll(state, "_", " ")),
+		Properties: props,
+		StartTime:  new(endTime.UnixMilli()),
+		EndTime:    new(endTime.UnixMilli()),
+	}
+	if config.Config.EventDurations && step.StartedTime != nil {
+		ingest.StartTime = new(step.StartedTime.UnixMilli())
+	}
+	if isFailedCheck(step, state) {
+		addFailure(ingest, event, step, state)
+	}
+	applyEventTemplate(eventStepCompleted, ingest, event, &step)
+	return ingest, nil
+}
+
+// stepTitle returns the title of the event of an ended step. The suffix tells the outcome.
+func stepTitle(step event_kit_api.ExperimentStepExecution, suffix string) string {
+	return fmt.Sprintf("Steadybit experiment '%s / %g' - %s '%s'%s",
+		step.ExperimentKey,
+		step.ExecutionId,
+		actionKindLabel(step),
+		getActionName(step),
+		suffix)
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func forwardActionKinds(t *testing.T, stepCompleted bool, kinds ...string) {
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventActionKinds = kinds
+	config.Config.EventStepCompleted = stepCompleted
+}
+
+func stepCompletedEvent(kind event_kit_api.ExperimentStepExecutionActionKind, state event_kit_api.ExperimentStepExecutionState) *event_kit_api.EventRequestBody {
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 3, 0, 0, time.UTC)
+	return &event_kit_api.EventRequestBody{
+		Environment: new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentStepExecution: new(event_kit_api.ExperimentStepExecution{
+			ExecutionId:   42,
+			ExperimentKey: "KEY",
+			Id:            uuid.New(),
+			Type:          event_kit_api.Action,
+			ActionId:      new("com.steadybit.extension_http.check.periodically"),
+			ActionName:    new("HTTP (Periodically)"),
+			ActionKind:    extutil.Ptr(kind),
+			State:         state,
+			StartedTime:   &startedTime,
+			EndedTime:     &endedTime,
+		}),
+	}
+}
+
+func Test_onExperimentStepCompleted_FailedCheckIsError(t *testing.T) {
+	forwardActionKinds(t, true, "attack", "check")
+	event := stepCompletedEvent(event_kit_api.Check, event_kit_api.ExperimentStepExecutionStateFailed)
+	event.ExperimentExecution = new(event_kit_api.ExperimentExecution{Reason: new("Check failed"), ReasonDetails: new("Success rate 42% below 95%")})
+
+	got, err := onExperimentStepCompleted(event)
+
+	require.NoError(t, err)
+	assert.Equal(t, types.EventTypeError, got.EventType)
+	assert.Equal(t, "Steadybit experiment 'KEY / 42' - Check 'HTTP (Periodically)' failed", got.Title)
+	assert.Equal(t, "Check 'HTTP (Periodically)' failed: Check failed - Success rate 42% below 95%", got.Properties["dt.event.description"])
+	assert.Equal(t, "Check failed - Success rate 42% below 95%", got.Properties["steadybit.failure.reason"])
+	assert.Equal(t, "failed", got.Properties["steadybit.step.state"])
+	assert.Equal(t, new(time.Date(2021, 1, 1, 0, 3, 0, 0, time.UTC).UnixMilli()), got.StartTime)
+}
+
+func Test_onExperimentStepCompleted_SuccessfulLoadTest(t *testing.T) {
+	forwardActionKinds(t, true, "load_test")
+	enableEventDurations(t)
+
+	got, err := onExperimentStepCompleted(stepCompletedEvent(event_kit_api.LoadTest, event_kit_api.ExperimentStepExecutionStateCompleted))
+
+	require.NoError(t, err)
+	assert.Equal(t, types.EventTypeCustomInfo, got.EventType)
+	assert.Equal(t, "Steadybit experiment 'KEY / 42' - Load test 'HTTP (Periodically)' completed", got.Title)
+	assert.NotContains(t, got.Properties, "dt.event.description")
+	assert.Equal(t, new(time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC).UnixMilli()), got.StartTime)
+}
+
+func Test_onExperimentStepCompleted_ConfiguredEventTypeWins(t *testing.T) {
+	forwardActionKinds(t, true, "check")
+	config.Config.EventTypes = map[string]string{"experiment.step.completed/failed": types.EventTypeCustomAlert}
+
+	got, err := onExperimentStepCompleted(stepCompletedEvent(event_kit_api.Check, event_kit_api.ExperimentStepExecutionStateFailed))
+
+	require.NoError(t, err)
+	assert.Equal(t, types.EventTypeCustomAlert, got.EventType)
+}
+
+func Test_onExperimentStepCompleted_Skipped(t *testing.T) {
+	forwardActionKinds(t, false, "check")
+	got, err := onExperimentStepCompleted(stepCompletedEvent(event_kit_api.Check, event_kit_api.ExperimentStepExecutionStateFailed))
+	require.NoError(t, err)
+	assert.Nil(t, got, "step events disabled")
+
+	forwardActionKinds(t, true, "attack")
+	got, err = onExperimentStepCompleted(stepCompletedEvent(event_kit_api.Check, event_kit_api.ExperimentStepExecutionStateFailed))
+	require.NoError(t, err)
+	assert.Nil(t, got, "kind not forwarded")
+}
+
+func Test_onExperimentTargetCompleted_FailedCheck(t *testing.T) {
+	forwardActionKinds(t, false, "check")
+	step := stepCompletedEvent(event_kit_api.Check, event_kit_api.ExperimentStepExecutionStateRunning)
+	_, err := onExperimentStepStarted(step)
+	require.NoError(t, err)
+	endedTime := time.Date(2021, 1, 1, 0, 3, 0, 0, time.UTC)
+
+	got, err := onExperimentTargetCompleted(&event_kit_api.EventRequestBody{
+		Environment: step.Environment,
+		ExperimentStepTargetExecution: new(event_kit_api.ExperimentStepTargetExecution{
+			ExecutionId:     42,
+			ExperimentKey:   "KEY",
+			Id:              uuid.New(),
+			StepExecutionId: step.ExperimentStepExecution.Id,
+			State:           "errored",
+			TargetName:      "checkout",
+			EndedTime:       &endedTime,
+		}),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, types.EventTypeError, got.EventType)
+	assert.Equal(t, "Steadybit experiment 'KEY / 42' - Check 'HTTP (Periodically)' ended - Target 'checkout'", got.Title)
+	assert.Equal(t, "Check 'HTTP (Periodically)' errored", got.Properties["dt.event.description"])
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/types"
+)
+
+// eventTemplateData is available to the title and property templates.
+type eventTemplateData struct {
+	// Event is the full Steadybit event
+	Event *event_kit_api.EventRequestBody
+	// Step is the step execution of target events, nil otherwise
+	Step *event_kit_api.ExperimentStepExecution
+	// Target is the target execution of target events, nil otherwise
+	Target *event_kit_api.ExperimentStepTargetExecution
+	// Attributes are the attributes of the target
+	Attributes map[string][]string
+	// Title is the default title of the event
+	Title string
+}
+
+// Attribute returns the first value of the target attribute, or an empty string.
+func (d eventTemplateData) Attribute(name string) string {
+	if values := d.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// applyEventTemplate replaces the title and adds the properties configured for the Steadybit event. If a template
+// fails to render, the default is kept.
+func applyEventTemplate(name string, ingest *types.EventIngest, event *event_kit_api.EventRequestBody, step *event_kit_api.ExperimentStepExecution) {
+	eventTemplate, ok := config.Config.EventTemplates[name]
+	if !ok || eventTemplate == nil {
+		return
+	}
+	data := eventTemplateData{Event: event, Step: step, Target: event.ExperimentStepTargetExecution, Title: ingest.Title}
+	if data.Target != nil {
+		data.Attributes = data.Target.TargetAttributes
+	}
+
+	if title, ok, err := eventTemplate.RenderTitle(data); err != nil {
+		log.Warn().Err(err).Str("event", name).Msg("Failed to render event title, using the default.")
+	} else if ok {
+		ingest.Title = title
+	}
+	properties, err := eventTemplate.RenderProperties(data)
+	if err != nil {
+		log.Warn().Err(err).Str("event", name).Msg("Failed to render event properties.")
+	}
+	if ingest.Properties == nil {
+		ingest.Properties = make(map[string]string, len(properties))
+	}
+	for key, value := range properties {
+		ingest.Properties[key] = value
+	}
+}
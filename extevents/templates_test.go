@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setEventTemplates(t *testing.T, value string) {
+	previous := config.Config
+	t.Cleanup(func() { config.Config = previous })
+	config.Config.EventTemplates = nil
+	require.NoError(t, config.Config.EventTemplates.Decode(value))
+}
+
+func Test_applyEventTemplate_ExperimentEvent(t *testing.T) {
+	setEventTemplates(t, `{"experiment.started":{
+		"title":"Chaos experiment {{.Event.ExperimentExecution.Name}} by {{.Event.Team.Key}}",
+		"properties":{"ticket":"{{.Event.ExperimentExecution.Hypothesis}}"}}}`)
+
+	got, err := onExperimentStarted(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		Team:                new(event_kit_api.Team{Key: "SHOP", Name: "Shop"}),
+		EventTime:           time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC),
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 7, ExperimentKey: "KEY", Name: "Checkout latency", Hypothesis: "OPS-42"}),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Chaos experiment Checkout latency by SHOP", got.Title)
+	assert.Equal(t, "OPS-42", got.Properties["ticket"])
+	assert.Equal(t, "KEY", got.Properties["steadybit.experiment.key"])
+}
+
+func Test_applyEventTemplate_TargetEvent(t *testing.T) {
+	setEventTemplates(t, `{"experiment.step.target.started":{
+		"title":"{{.Title}} in {{.Attribute \"k8s.cluster-name\"}}",
+		"properties":{"action":"{{.Step.ActionId}}","service":"{{.Attribute \"k8s.deployment\"}}"}}}`)
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	step, started, _ := attackEvents(startedTime, startedTime)
+	started.ExperimentStepTargetExecution.TargetAttributes = map[string][]string{"k8s.cluster-name": {"prod"}, "k8s.deployment": {"checkout"}}
+
+	_, err := onExperimentStepStarted(&step)
+	require.NoError(t, err)
+	got, err := onExperimentTargetStarted(&started)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Steadybit experiment 'ExperimentKey / 42' - Attack 'some_action_id' started - Target 'test' in prod", got.Title)
+	assert.Equal(t, "some_action_id", got.Properties["action"])
+	assert.Equal(t, "checkout", got.Properties["service"])
+}
+
+func Test_applyEventTemplate_KeepsDefaultsIfRenderingFails(t *testing.T) {
+	setEventTemplates(t, `{"experiment.started":{"title":"{{.Event.ExperimentExecution.Unknown}}","properties":{"team":"{{.Event.Team.Key}}"}}}`)
+
+	got, err := onExperimentStarted(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{ExecutionId: 7, ExperimentKey: "KEY"}),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Steadybit experiment 'KEY / 7' started", got.Title)
+	assert.NotContains(t, got.Properties, "team")
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-dynatrace/config"
+)
+
+// eventJob is an incoming event waiting to be turned into a Dynatrace event.
+type eventJob struct {
+	path    string
+	event   event_kit_api.EventRequestBody
+	handler eventHandler
+}
+
+// workerPool processes incoming events with a fixed number of workers. Each worker has its own backlog and events
+// with the same key always go to the same worker, so they are processed in the order they arrived.
+type workerPool struct {
+	backlogs []chan eventJob
+	pending  atomic.Int64
+	wg       sync.WaitGroup
+	// mutex guards stopped, submit holds it shared while sending to a backlog, so stop doesn't close it meanwhile
+	mutex   sync.RWMutex
+	stopped bool
+}
+
+var workers *workerPool
+
+func newWorkerPool(size int, backlog int, process func(job eventJob)) *workerPool {
+	size = config.IntOrDefault(size, 4)
+	perWorker := max(config.IntOrDefault(backlog, 1000)/size, 1)
+	p := &workerPool{backlogs: make([]chan eventJob, size)}
+	for i := range p.backlogs {
+		jobs := make(chan eventJob, perWorker)
+		p.backlogs[i] = jobs
+		p.wg.Go(func() {
+			for job := range jobs {
+				process(job)
+				p.pending.Add(-1)
+			}
+		})
+	}
+	return p
+}
+
+// submit hands the job to the worker for the key. It blocks while the backlog of the worker is full and returns
+// false if the context ends before or the pool is stopped.
+func (p *workerPool) submit(ctx context.Context, key string, job eventJob) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.stopped {
+		return false
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	p.pending.Add(1)
+	select {
+	case p.backlogs[h.Sum32()%uint32(len(p.backlogs))] <- job:
+		return true
+	case <-ctx.Done():
+		p.pending.Add(-1)
+		return false
+	}
+}
+
+// depth returns the number of events waiting for or being processed by a worker.
+func (p *workerPool) depth() int {
+	return int(p.pending.Load())
+}
+
+// stop processes the backlog and waits for the workers to finish. Jobs submitted afterwards are rejected.
+func (p *workerPool) stop() {
+	p.mutex.Lock()
+	if !p.stopped {
+		p.stopped = true
+		for _, jobs := range p.backlogs {
+			close(jobs)
+		}
+	}
+	p.mutex.Unlock()
+	p.wg.Wait()
+}
+
+// orderingKey returns the key that keeps the events of an experiment execution in order.
+func orderingKey(event *event_kit_api.EventRequestBody) string {
+	switch {
+	case event.ExperimentExecution != nil:
+		return strconv.FormatFloat(float64(event.ExperimentExecution.ExecutionId), 'f', 0, 32)
+	case event.ExperimentStepExecution != nil:
+		return strconv.FormatFloat(float64(event.ExperimentStepExecution.ExecutionId), 'f', 0, 32)
+	case event.ExperimentStepTargetExecution != nil:
+		return strconv.FormatFloat(float64(event.ExperimentStepTargetExecution.ExecutionId), 'f', 0, 32)
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_workerPool_KeepsOrderPerKey(t *testing.T) {
+	var mutex sync.Mutex
+	processed := make(map[string][]string)
+	pool := newWorkerPool(4, 100, func(job eventJob) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		processed[job.event.EventName] = append(processed[job.event.EventName], job.path)
+	})
+
+	for i := range 20 {
+		for _, key := range []string{"1", "2", "3"} {
+			pool.submit(context.Background(), key, eventJob{path: fmt.Sprint(i), event: event_kit_api.EventRequestBody{EventName: key}})
+		}
+	}
+	pool.stop()
+
+	expected := make([]string, 20)
+	for i := range expected {
+		expected[i] = fmt.Sprint(i)
+	}
+	for _, key := range []string{"1", "2", "3"} {
+		assert.Equal(t, expected, processed[key], key)
+	}
+	assert.Equal(t, 0, pool.depth())
+}
+
+func Test_workerPool_BlocksWhenBacklogIsFull(t *testing.T) {
+	release := make(chan struct{})
+	pool := newWorkerPool(1, 1, func(job eventJob) { <-release })
+	defer pool.stop()
+	defer close(release)
+
+	// One job is processed, one waits in the backlog
+	assert.True(t, pool.submit(context.Background(), "1", eventJob{}))
+	assert.True(t, pool.submit(context.Background(), "1", eventJob{}))
+	assert.Eventually(t, func() bool { return pool.depth() == 2 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.False(t, pool.submit(ctx, "1", eventJob{}))
+	assert.Equal(t, 2, pool.depth())
+}
+
+func Test_workerPool_RejectsJobsWhenStopped(t *testing.T) {
+	pool := newWorkerPool(2, 10, func(job eventJob) {})
+	pool.stop()
+
+	assert.False(t, pool.submit(context.Background(), "1", eventJob{}))
+	assert.Equal(t, 0, pool.depth())
+	pool.stop()
+}
+
+func Test_handle_RespondsUnavailableWhenStopped(t *testing.T) {
+	previous := workers
+	t.Cleanup(func() { workers = previous })
+	workers = newWorkerPool(1, 1, func(job eventJob) {})
+	workers.stop()
+	recorder := httptest.NewRecorder()
+
+	handle(onExperimentStarted)(recorder, httptest.NewRequest(http.MethodPost, "/events/experiment-started", nil),
+		[]byte(`{"environment":{"name":"gateway"},"experimentExecution":{"experimentKey":"KEY"}}`))
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func Test_orderingKey(t *testing.T) {
+	assert.Equal(t, "42", orderingKey(&event_kit_api.EventRequestBody{ExperimentExecution: &event_kit_api.ExperimentExecution{ExecutionId: 42}}))
+	assert.Equal(t, "42", orderingKey(&event_kit_api.EventRequestBody{ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{ExecutionId: 42}}))
+	assert.Equal(t, "", orderingKey(&event_kit_api.EventRequestBody{}))
+}
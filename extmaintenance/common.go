@@ -3,6 +3,11 @@
 
 package extmaintenance
 
+import "github.com/steadybit/extension-dynatrace/config"
+
+// RequiredScopes are the scopes the Dynatrace API token needs to create maintenance windows
+var RequiredScopes = []string{config.ScopeSettingsWrite}
+
 const (
 	MaintenanceActionId   = "com.steadybit.extension_dynatrace.create_maintenance_window"
 	maintenanceActionIcon = "data:image/svg+xml;base64,PD94bWwgdmVyc2lvbj0iMS4wIiBlbmNvZGluZz0idXRmLTgiPz4KPHN2ZyBmaWxsPSJjdXJyZW50Q29sb3IiIHZpZXdCb3g9IjAgMCAyNCAyNCIgcm9sZT0iaW1nIiB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciPjxwYXRoIGQ9Ik05LjM3MyAwYy0uMzEuMDA2LS45My4wOS0xLjUyMS42NTRDNi45OCAxLjQ3OCAyLjYyOCA1LjYxLjg4IDcuMjcuMDkgOC4wMjQuMTYgOC44NjUuMTYgOC45MzR2LjM3N2MuMDY3LS4yOTIuMTg3LS40OTkuNDI3LS44MjUuNDk2LS42MTYgMS4zLS43ODggMS42MjctLjgyMmE2NC4yMzMgNjQuMjMzIDAgMCAxIC4wMDIgMCA2NC4yMzMgNjQuMjMzIDAgMCAxIDYuNTI3LS41NDljNC4zMzUtLjEzNyA3LjE5Ny4yMjUgNy4xOTcuMjI1bDYuMDg0LTUuNzkzcy0zLjE4OC0uNi02LjgyLTEuMDI3QTkzLjM5NCA5My4zOTQgMCAwIDAgOS41NjYuMDA2Yy0uMDIxIDAtLjA5LS4wMDgtLjE5My0uMDA2em0xMy41NiAyLjUwOGwtNi4wNjYgNS43OXMuMjIyIDIuODgtLjEzNyA3LjE5OGMtLjE4OSAyLjQ1LS41ODQgNC44NjYtLjg3NSA2LjQ5NC0uMDUyLjMyNi0uMjU2IDEuMTE0LS45MjUgMS41OTQtLjI5LjE5OC0uNDkxLjI5NS0uNzQ4LjM2MyAxLjU0Ni0uNTEgMS4wOTEtNy4wNDcgMS4wOTEtNy4wNDctNC4zMzUuMTM3LTcuMjE0LS4yMjItNy4yMTQtLjIyMkwxLjk3NSAyMi40N3MzLjIyMi42MzQgNi44NTUgMS4wNDVjMi4wNTYuMjQgNC44MzMuNDI5IDUuMjI3LjQ2My4wMjMgMCAuMDQ1LS4wMDcuMDY4LS4wMTItLjAxMy4wMDMtLjAyMi4wMDktLjAzNS4wMTIuMTM4IDAgLjI1OS4wMTUuMzc5LjAxNS4wODUgMCAuOTI1LjEwNSAxLjcxMy0uNjQ4IDEuNzQ4LTEuNjYzIDYuMDgzLTUuODEgNi45NC02LjYzMy43ODgtLjc1NC43Mi0xLjU5NC43Mi0xLjY4YTgxLjg0IDgxLjg0IDAgMCAwLS4yMDctNS42NTRjLS4yNC0zLjY1LS43MDEtNi44NzEtLjcwMS02Ljg3MXpNMy44NTYgOC4zMDVDMi4xMjUgOC4zMDcuMzQ4IDguNTEzLjE2IDkuMzI2Yy4wMTcgMS4yMTYuMDUgMy4xMzcuMjA1IDUuMjguMjQgMy42NS43MDMgNi44ODYuNzAzIDYuODg2bDYuMDgyLTUuNzljLS4wMTcuMDE3LS4yMzktMi44OC4xMjEtNy4xOThINy4yN3MtMS42ODQtLjIwMi0zLjQxNS0uMnoiLz48L3N2Zz4="
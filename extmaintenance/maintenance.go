@@ -12,8 +12,8 @@ import (
 	"github.com/steadybit/action-kit/go/action_kit_api/v2"
 	"github.com/steadybit/action-kit/go/action_kit_sdk"
 	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/extmetrics"
 	"github.com/steadybit/extension-dynatrace/types"
-	extension_kit "github.com/steadybit/extension-kit"
 	"github.com/steadybit/extension-kit/extbuild"
 	"github.com/steadybit/extension-kit/extutil"
 )
@@ -34,6 +34,7 @@ type CreateMaintenanceWindowState struct {
 	ExecutionUri        *string
 	ExperimentKey       *string
 	ExecutionId         *int
+	Tenant              string
 }
 
 func NewMaintenanceAction() action_kit_sdk.Action[CreateMaintenanceWindowState] {
@@ -48,7 +49,7 @@ const DetectProblemsDontAlert = "DETECT_PROBLEMS_DONT_ALERT"
 const DontDetectProblems = "DONT_DETECT_PROBLEMS"
 
 func (m *CreateMaintenanceWindowAction) Describe() action_kit_api.ActionDescription {
-	return action_kit_api.ActionDescription{
+	description := action_kit_api.ActionDescription{
 		Id:          MaintenanceActionId,
 		Label:       "Create Maintenance Window",
 		Description: "Create a Maintenance Window for a given duration.",
@@ -93,6 +94,10 @@ func (m *CreateMaintenanceWindowAction) Describe() action_kit_api.ActionDescript
 		},
 		Stop: new(action_kit_api.MutatingEndpointReference{}),
 	}
+	if tenant := config.TenantParameter(2); tenant != nil {
+		description.Parameters = append(description.Parameters, *tenant)
+	}
+	return description
 }
 
 func (m *CreateMaintenanceWindowAction) Prepare(_ context.Context, state *CreateMaintenanceWindowState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
@@ -105,15 +110,36 @@ func (m *CreateMaintenanceWindowAction) Prepare(_ context.Context, state *Create
 	state.ExecutionUri = request.ExecutionContext.ExecutionUri
 	state.ExperimentKey = request.ExecutionContext.ExperimentKey
 	state.ExecutionId = request.ExecutionContext.ExecutionId
+
+	spec, err := config.ForTenant(extutil.ToString(request.Config["tenant"]))
+	if err != nil {
+		return nil, config.ToError("Failed to prepare maintenance window.", err)
+	}
+	state.Tenant = spec.TenantName()
 	return nil, nil
 }
 
 func (m *CreateMaintenanceWindowAction) Start(ctx context.Context, state *CreateMaintenanceWindowState) (*action_kit_api.StartResult, error) {
-	return CreateMaintenanceWindow(ctx, state, &config.Config)
+	spec, err := config.ForTenant(state.Tenant)
+	if err != nil {
+		return nil, config.ToError("Failed to create maintenance windows.", err)
+	}
+	result, err := CreateMaintenanceWindow(ctx, state, spec)
+	if err == nil {
+		extmetrics.ActiveActions.WithLabelValues(MaintenanceActionId).Inc()
+	}
+	return result, err
 }
 
 func (m *CreateMaintenanceWindowAction) Stop(ctx context.Context, state *CreateMaintenanceWindowState) (*action_kit_api.StopResult, error) {
-	return DeleteMaintenanceWindow(ctx, state, &config.Config)
+	spec, err := config.ForTenant(state.Tenant)
+	if err != nil {
+		return nil, config.ToError("Failed to delete maintenance window.", err)
+	}
+	if state.MaintenanceWindowId != nil {
+		defer extmetrics.ActiveActions.WithLabelValues(MaintenanceActionId).Dec()
+	}
+	return DeleteMaintenanceWindow(ctx, state, spec)
 }
 
 type MaintenanceWindowApi interface {
@@ -160,7 +186,7 @@ func CreateMaintenanceWindow(ctx context.Context, state *CreateMaintenanceWindow
 
 	windowId, _, err := api.CreateMaintenanceWindow(ctx, createRequest)
 	if err != nil {
-		return nil, extension_kit.ToError("Failed to create maintenance windows.", err)
+		return nil, config.ToError("Failed to create maintenance windows.", err)
 	}
 
 	state.MaintenanceWindowId = windowId
@@ -179,7 +205,7 @@ func DeleteMaintenanceWindow(ctx context.Context, state *CreateMaintenanceWindow
 
 	resp, err := api.DeleteMaintenanceWindow(ctx, *state.MaintenanceWindowId)
 	if err != nil {
-		return nil, extension_kit.ToError(fmt.Sprintf("Failed to delete maintenace window (id %s). Full response: %v", *state.MaintenanceWindowId, resp), err)
+		return nil, config.ToError(fmt.Sprintf("Failed to delete maintenace window (id %s). Full response: %v", *state.MaintenanceWindowId, resp), err)
 	}
 
 	return &action_kit_api.StopResult{
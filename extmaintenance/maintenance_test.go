@@ -56,6 +56,26 @@ func TestCreateMaintenanceWindowPrepareExtractsState(t *testing.T) {
 	require.True(t, state.End.After(time.Now()))
 }
 
+func TestCreateMaintenanceWindowPrepareRejectsUnknownTenant(t *testing.T) {
+	// Given
+	request := extutil.JsonMangle(action_kit_api.PrepareActionRequestBody{
+		Config: map[string]any{
+			"duration":        1000 * 60,
+			"suppressionType": "DETECT_PROBLEMS_DONT_ALERT",
+			"tenant":          "unknown",
+		},
+		ExecutionContext: new(action_kit_api.ExecutionContext{}),
+	})
+	action := CreateMaintenanceWindowAction{}
+	state := action.NewEmptyState()
+
+	// When
+	_, err := action.Prepare(context.TODO(), &state, request)
+
+	// Then
+	require.ErrorContains(t, err, "unknown Dynatrace tenant 'unknown'")
+}
+
 func TestCreateMaintenanceWindowStartSuccess(t *testing.T) {
 	// Given
 	mockedApi := new(dynatraceApiMock)
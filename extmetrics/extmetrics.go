@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2026 Steadybit GmbH
+
+package extmetrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "steadybit_extension_dynatrace"
+
+// Registry holds all metrics of the extension. The default registry is not used, so only the metrics below and the
+// Go runtime metrics are exposed.
+var Registry = prometheus.NewRegistry()
+
+var (
+	ApiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Requests sent to the Dynatrace API per tenant, operation and status code. Failed connections have the code 'error'.",
+	}, []string{"tenant", "operation", "code"})
+
+	ApiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Duration of requests to the Dynatrace API per tenant and operation, each retry is observed separately.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"tenant", "operation"})
+
+	ApiThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_throttled_total",
+		Help:      "Requests held back by the client-side rate limit per tenant and API family. The result is 'waited' or 'rejected'.",
+	}, []string{"tenant", "family", "result"})
+
+	ApiThrottledSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_throttled_seconds_total",
+		Help:      "Time requests waited for the client-side rate limit per tenant and API family.",
+	}, []string{"tenant", "family"})
+
+	EventsForwarded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_forwarded_total",
+		Help:      "Steadybit events received per listener path. The result is 'success', 'failure', 'skipped' for events not sent to Dynatrace or 'filtered' for events excluded by the event filters.",
+	}, []string{"path", "result"})
+
+	ActiveActions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_actions",
+		Help:      "Currently running actions per action id.",
+	}, []string{"action"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ApiRequests,
+		ApiRequestDuration,
+		ApiThrottled,
+		ApiThrottledSeconds,
+		EventsForwarded,
+		ActiveActions,
+	)
+}
+
+// RegisterGaugeFunc exposes a value that is computed on each scrape, like the size of a cache.
+func RegisterGaugeFunc(name string, help string, value func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, value))
+}
+
+// RegisterCounterFunc exposes a counter that is maintained elsewhere, like the hits of a cache.
+func RegisterCounterFunc(name string, help string, value func() float64) {
+	Registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, value))
+}
+
+// RegisterMetricsHandler exposes the metrics at /metrics in the Prometheus text format.
+func RegisterMetricsHandler() {
+	http.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+}
@@ -0,0 +1,38 @@
+package extmetrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var registerOnce sync.Once
+
+func TestMetricsHandlerExposesMetrics(t *testing.T) {
+	registerOnce.Do(func() {
+		RegisterGaugeFunc("test_gauge", "A gauge for the test.", func() float64 { return 42 })
+		RegisterMetricsHandler()
+	})
+	ApiRequests.WithLabelValues("default", "getProblems", "200").Inc()
+	EventsForwarded.WithLabelValues("/events/experiment-started", "success").Inc()
+
+	srv := httptest.NewServer(http.DefaultServeMux)
+	defer srv.Close()
+
+	response, err := http.Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	defer func() { _ = response.Body.Close() }()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), `steadybit_extension_dynatrace_api_requests_total{code="200",operation="getProblems",tenant="default"}`)
+	assert.Contains(t, string(body), `steadybit_extension_dynatrace_events_forwarded_total{path="/events/experiment-started",result="success"}`)
+	assert.Contains(t, string(body), `steadybit_extension_dynatrace_test_gauge 42`)
+	assert.Contains(t, string(body), `go_goroutines`)
+}
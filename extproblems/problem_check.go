@@ -10,11 +10,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jellydator/ttlcache/v3"
 	"github.com/steadybit/action-kit/go/action_kit_api/v2"
 	"github.com/steadybit/action-kit/go/action_kit_sdk"
 	"github.com/steadybit/extension-dynatrace/config"
+	"github.com/steadybit/extension-dynatrace/extmetrics"
 	"github.com/steadybit/extension-dynatrace/types"
-	extension_kit "github.com/steadybit/extension-kit"
 	"github.com/steadybit/extension-kit/extbuild"
 	"github.com/steadybit/extension-kit/extutil"
 )
@@ -39,9 +41,25 @@ type ProblemCheckState struct {
 	// that the condition was violated during the step so the failure can be reported once the step ends.
 	DeviationSeen  bool
 	DeviationTitle string
+	Tenant         string
+	ExecutionId    uuid.UUID
+}
+
+// activeCheckGrace is how long after its end a check without further status calls, like of a canceled experiment,
+// still counts as active in the metrics
+const activeCheckGrace = time.Minute
+
+// activeChecks holds the running checks counted in the ActiveActions gauge, the gauge is decremented on eviction
+var activeChecks = ttlcache.New[uuid.UUID, struct{}](ttlcache.WithDisableTouchOnHit[uuid.UUID, struct{}]())
+
+func init() {
+	activeChecks.OnEviction(func(_ context.Context, _ ttlcache.EvictionReason, _ *ttlcache.Item[uuid.UUID, struct{}]) {
+		extmetrics.ActiveActions.WithLabelValues(ProblemCheckActionId).Dec()
+	})
 }
 
 func NewProblemCheckAction() action_kit_sdk.Action[ProblemCheckState] {
+	go activeChecks.Start()
 	return &ProblemCheckAction{}
 }
 
@@ -50,7 +68,7 @@ func (m *ProblemCheckAction) NewEmptyState() ProblemCheckState {
 }
 
 func (m *ProblemCheckAction) Describe() action_kit_api.ActionDescription {
-	return action_kit_api.ActionDescription{
+	description := action_kit_api.ActionDescription{
 		Id:          ProblemCheckActionId,
 		Label:       "Problem Check",
 		Description: "Checks for the existence of open problems in Dynatrace.",
@@ -161,6 +179,10 @@ func (m *ProblemCheckAction) Describe() action_kit_api.ActionDescription {
 			CallInterval: new("5s"),
 		}),
 	}
+	if tenant := config.TenantParameter(6); tenant != nil {
+		description.Parameters = append(description.Parameters, *tenant)
+	}
+	return description
 }
 
 func (m *ProblemCheckAction) Prepare(_ context.Context, state *ProblemCheckState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
@@ -186,14 +208,25 @@ func (m *ProblemCheckAction) Prepare(_ context.Context, state *ProblemCheckState
 		state.FailEarly = extutil.ToBool(request.Config["failEarly"])
 	}
 
+	spec, err := config.ForTenant(extutil.ToString(request.Config["tenant"]))
+	if err != nil {
+		return nil, config.ToError("Failed to prepare problem check.", err)
+	}
+	state.Tenant = spec.TenantName()
+	state.ExecutionId = request.ExecutionId
 	return nil, nil
 }
 
 func (m *ProblemCheckAction) Start(ctx context.Context, state *ProblemCheckState) (*action_kit_api.StartResult, error) {
-	statusResult, err := ProblemCheckStatus(ctx, state, &config.Config)
+	spec, err := config.ForTenant(state.Tenant)
+	if err != nil {
+		return nil, config.ToError("Failed to get problems from Dynatrace.", err)
+	}
+	statusResult, err := ProblemCheckStatus(ctx, state, spec)
 	if statusResult == nil {
 		return nil, err
 	}
+	countActive(state, statusResult)
 	startResult := action_kit_api.StartResult{
 		Artifacts: statusResult.Artifacts,
 		Error:     statusResult.Error,
@@ -204,7 +237,25 @@ func (m *ProblemCheckAction) Start(ctx context.Context, state *ProblemCheckState
 }
 
 func (m *ProblemCheckAction) Status(ctx context.Context, state *ProblemCheckState) (*action_kit_api.StatusResult, error) {
-	return ProblemCheckStatus(ctx, state, &config.Config)
+	spec, err := config.ForTenant(state.Tenant)
+	if err != nil {
+		return nil, config.ToError("Failed to get problems from Dynatrace.", err)
+	}
+	statusResult, err := ProblemCheckStatus(ctx, state, spec)
+	if statusResult == nil || statusResult.Completed || statusResult.Error != nil {
+		activeChecks.Delete(state.ExecutionId)
+	}
+	return statusResult, err
+}
+
+// countActive counts a started check in the ActiveActions gauge until a status call completes it. Checks that get
+// no further status calls, like those of canceled experiments, are no longer counted shortly after their end.
+func countActive(state *ProblemCheckState, result *action_kit_api.StatusResult) {
+	if result.Completed || result.Error != nil {
+		return
+	}
+	activeChecks.Set(state.ExecutionId, struct{}{}, max(time.Until(state.End), 0)+activeCheckGrace)
+	extmetrics.ActiveActions.WithLabelValues(ProblemCheckActionId).Inc()
 }
 
 type ProblemsApi interface {
@@ -215,7 +266,7 @@ func ProblemCheckStatus(ctx context.Context, state *ProblemCheckState, api Probl
 	now := time.Now()
 	problems, _, err := api.GetProblems(ctx, state.Start, state.EntitySelector)
 	if err != nil {
-		return nil, extension_kit.ToError("Failed to get problems from Dynatrace.", err)
+		return nil, config.ToError("Failed to get problems from Dynatrace.", err)
 	}
 
 	completed := now.After(state.End)
@@ -275,9 +326,14 @@ func ProblemCheckStatus(ctx context.Context, state *ProblemCheckState, api Probl
 		}
 	}
 
+	// Link the problems in the UI of the tenant they belong to
+	uiSpec := &config.Config
+	if spec, err := config.ForTenant(state.Tenant); err == nil {
+		uiSpec = spec
+	}
 	var metrics []action_kit_api.Metric
 	for _, problem := range problems {
-		metrics = append(metrics, toMetric(problem, now))
+		metrics = append(metrics, toMetric(problem, now, uiSpec))
 	}
 
 	return &action_kit_api.StatusResult{
@@ -287,7 +343,7 @@ func ProblemCheckStatus(ctx context.Context, state *ProblemCheckState, api Probl
 	}, nil
 }
 
-func toMetric(problem types.Problem, now time.Time) action_kit_api.Metric {
+func toMetric(problem types.Problem, now time.Time, spec *config.Specification) action_kit_api.Metric {
 	var tooltip strings.Builder
 	tooltip.WriteString(problem.DisplayId)
 	for _, entity := range problem.AffectedEntities {
@@ -301,7 +357,7 @@ func toMetric(problem types.Problem, now time.Time) action_kit_api.Metric {
 			"dynatrace.problem.title": problem.Title,
 			"state":                   "danger",
 			"tooltip":                 tooltip.String(),
-			"url":                     fmt.Sprintf("%s%s;pid=%s", config.Config.UiBaseUrl, config.Config.UiProblemsPath, problem.ProblemId),
+			"url":                     fmt.Sprintf("%s%s;pid=%s", spec.UiBaseUrl, spec.UiProblemsPath, problem.ProblemId),
 		},
 		Timestamp: now,
 		Value:     0,
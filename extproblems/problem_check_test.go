@@ -5,7 +5,10 @@ package extproblems
 
 import (
 	"context"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-dynatrace/extmetrics"
 	"github.com/steadybit/extension-dynatrace/types"
 	"github.com/steadybit/extension-kit/extutil"
 	"github.com/stretchr/testify/mock"
@@ -142,3 +145,35 @@ func TestAllTheTimeFailAtEndSucceedsWhenNeverDeviated(t *testing.T) {
 	require.Nil(t, result.Error)
 	require.False(t, state.DeviationSeen)
 }
+
+func TestActiveCheckIsCountedUntilCompleted(t *testing.T) {
+	// Given - a started check
+	state := ProblemCheckState{ExecutionId: uuid.New(), End: time.Now().Add(time.Minute)}
+	gauge := extmetrics.ActiveActions.WithLabelValues(ProblemCheckActionId)
+	gauge.Set(0)
+	countActive(&state, &action_kit_api.StatusResult{})
+	require.Equal(t, 1.0, testutil.ToFloat64(gauge))
+
+	// When - the check completes and its completion is reported twice
+	activeChecks.Delete(state.ExecutionId)
+	activeChecks.Delete(state.ExecutionId)
+
+	// Then - the gauge is decremented once, evictions are handled asynchronously
+	require.Eventually(t, func() bool { return testutil.ToFloat64(gauge) == 0 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, 0.0, testutil.ToFloat64(gauge))
+}
+
+func TestCompletedCheckIsNotCounted(t *testing.T) {
+	// Given
+	state := ProblemCheckState{ExecutionId: uuid.New(), End: time.Now()}
+	gauge := extmetrics.ActiveActions.WithLabelValues(ProblemCheckActionId)
+	gauge.Set(0)
+
+	// When - the check completes on start
+	countActive(&state, &action_kit_api.StatusResult{Completed: true})
+
+	// Then
+	require.Equal(t, 0.0, testutil.ToFloat64(gauge))
+	require.False(t, activeChecks.Has(state.ExecutionId))
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/steadybit/extension-dynatrace/config"
 	"github.com/steadybit/extension-dynatrace/extevents"
 	"github.com/steadybit/extension-dynatrace/extmaintenance"
+	"github.com/steadybit/extension-dynatrace/extmetrics"
 	"github.com/steadybit/extension-dynatrace/extproblems"
 	"github.com/steadybit/extension-kit/extbuild"
 	"github.com/steadybit/extension-kit/exthealth"
@@ -31,18 +32,30 @@ func main() {
 	exthealth.StartProbes(8091)
 
 	config.ParseConfiguration()
-	config.ValidateConfiguration()
+	configValid := config.ValidateConfiguration()
 
-	extevents.RegisterEventListenerHandlers()
-
-	action_kit_sdk.RegisterAction(extmaintenance.NewMaintenanceAction())
-	action_kit_sdk.RegisterAction(extproblems.NewProblemCheckAction())
+	// Features whose scopes are missing in the API token are not registered, see config.HasScopes
+	eventListenersEnabled = config.HasScopes("Event forwarding", extevents.RequiredScopes()...)
+	if eventListenersEnabled {
+		config.HasScopes("Attaching events to Dynatrace entities", extevents.OptionalScopes...)
+		extevents.RegisterEventListenerHandlers()
+	}
+	maintenanceEnabled := config.HasScopes("The action 'Create Maintenance Window'", extmaintenance.RequiredScopes...)
+	if maintenanceEnabled {
+		action_kit_sdk.RegisterAction(extmaintenance.NewMaintenanceAction())
+	}
+	problemCheckEnabled := config.HasScopes("The action 'Problem Check'", extproblems.RequiredScopes...)
+	if problemCheckEnabled {
+		action_kit_sdk.RegisterAction(extproblems.NewProblemCheckAction())
+	}
 
 	exthttp.RegisterRevisionedHandler("/", getExtensionList)
+	extmetrics.RegisterMetricsHandler()
 	action_kit_sdk.RegisterCoverageEndpoints()
 	extsignals.ActivateSignalHandlers()
 
-	exthealth.SetReady(true)
+	// Stay unready if the token was rejected or doesn't allow to use any feature at all. The reason is logged above.
+	exthealth.SetReady(configValid && (eventListenersEnabled || maintenanceEnabled || problemCheckEnabled))
 	exthttp.Listen(exthttp.ListenOpts{
 		Port: 8090,
 	})
@@ -56,38 +69,55 @@ type ExtensionListResponse struct {
 	event_kit_api.EventListenerList `json:",inline"`
 }
 
+var eventListenersEnabled bool
+
 func getExtensionList() ExtensionListResponse {
 	return ExtensionListResponse{
-		ActionList:    action_kit_sdk.GetActionList(),
-		DiscoveryList: discovery_kit_sdk.GetDiscoveryList(),
-		EventListenerList: event_kit_api.EventListenerList{
-			EventListeners: []event_kit_api.EventListener{
-				{
-					Method:   "POST",
-					Path:     "/events/experiment-started",
-					ListenTo: []string{"experiment.execution.created"},
-				},
-				{
-					Method:   "POST",
-					Path:     "/events/experiment-completed",
-					ListenTo: []string{"experiment.execution.completed", "experiment.execution.failed", "experiment.execution.canceled", "experiment.execution.errored"},
-				},
-				{
-					Method:   "POST",
-					Path:     "/events/experiment-step-started",
-					ListenTo: []string{"experiment.execution.step-started"},
-				},
-				{
-					Method:   "POST",
-					Path:     "/events/experiment-target-started",
-					ListenTo: []string{"experiment.execution.target-started"},
-				},
-				{
-					Method:   "POST",
-					Path:     "/events/experiment-target-completed",
-					ListenTo: []string{"experiment.execution.target-completed", "experiment.execution.target-canceled", "experiment.execution.target-errored", "experiment.execution.target-failed"},
-				},
+		ActionList:        action_kit_sdk.GetActionList(),
+		DiscoveryList:     discovery_kit_sdk.GetDiscoveryList(),
+		EventListenerList: getEventListenerList(),
+	}
+}
+
+func getEventListenerList() event_kit_api.EventListenerList {
+	if !eventListenersEnabled {
+		return event_kit_api.EventListenerList{EventListeners: []event_kit_api.EventListener{}}
+	}
+	listeners := event_kit_api.EventListenerList{
+		EventListeners: []event_kit_api.EventListener{
+			{
+				Method:   "POST",
+				Path:     "/events/experiment-started",
+				ListenTo: []string{"experiment.execution.created"},
+			},
+			{
+				Method:   "POST",
+				Path:     "/events/experiment-completed",
+				ListenTo: []string{"experiment.execution.completed", "experiment.execution.failed", "experiment.execution.canceled", "experiment.execution.errored"},
+			},
+			{
+				Method:   "POST",
+				Path:     "/events/experiment-step-started",
+				ListenTo: []string{"experiment.execution.step-started"},
+			},
+			{
+				Method:   "POST",
+				Path:     "/events/experiment-target-started",
+				ListenTo: []string{"experiment.execution.target-started"},
+			},
+			{
+				Method:   "POST",
+				Path:     "/events/experiment-target-completed",
+				ListenTo: []string{"experiment.execution.target-completed", "experiment.execution.target-canceled", "experiment.execution.target-errored", "experiment.execution.target-failed"},
 			},
 		},
 	}
+	if config.Config.EventStepCompleted {
+		listeners.EventListeners = append(listeners.EventListeners, event_kit_api.EventListener{
+			Method:   "POST",
+			Path:     "/events/experiment-step-completed",
+			ListenTo: []string{"experiment.execution.step-completed", "experiment.execution.step-canceled", "experiment.execution.step-errored", "experiment.execution.step-failed"},
+		})
+	}
+	return listeners
 }
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type CreateMaintenanceWindowRequest struct {
 	SchemaId string            `json:"schemaId"`
 	Scope    string            `json:"scope"`
@@ -9,6 +11,7 @@ type CreateMaintenanceWindowRequest struct {
 type CreateMaintenanceWindowResponse struct {
 	Code     int    `json:"code"`
 	ObjectId string `json:"objectId"`
+	Error    *Error `json:"error"`
 }
 
 type MaintenanceWindow struct {
@@ -45,6 +48,24 @@ type EventIngest struct {
 	Title          string            `json:"title"`
 }
 
+// Event types accepted by the Dynatrace events API
+const (
+	EventTypeAvailability         = "AVAILABILITY_EVENT"
+	EventTypeCustomAlert          = "CUSTOM_ALERT"
+	EventTypeCustomAnnotation     = "CUSTOM_ANNOTATION"
+	EventTypeCustomConfiguration  = "CUSTOM_CONFIGURATION"
+	EventTypeCustomDeployment     = "CUSTOM_DEPLOYMENT"
+	EventTypeCustomInfo           = "CUSTOM_INFO"
+	EventTypeError                = "ERROR_EVENT"
+	EventTypeMarkedForTermination = "MARKED_FOR_TERMINATION"
+	EventTypePerformance          = "PERFORMANCE_EVENT"
+	EventTypeResourceContention   = "RESOURCE_CONTENTION_EVENT"
+)
+
+var EventTypes = []string{EventTypeAvailability, EventTypeCustomAlert, EventTypeCustomAnnotation, EventTypeCustomConfiguration,
+	EventTypeCustomDeployment, EventTypeCustomInfo, EventTypeError, EventTypeMarkedForTermination, EventTypePerformance,
+	EventTypeResourceContention}
+
 type EventIngestResult struct {
 	CorrelationId string `json:"correlationId"`
 	Status        string `json:"status"`
@@ -54,6 +75,52 @@ type EventIngestResults struct {
 	ReportCount        int                 `json:"reportCount"`
 }
 
+// BizEvent is a business event in the CloudEvents format
+type BizEvent struct {
+	SpecVersion string       `json:"specversion"`
+	Id          string       `json:"id"`
+	Source      string       `json:"source"`
+	Type        string       `json:"type"`
+	Time        time.Time    `json:"time"`
+	Data        BizEventData `json:"data"`
+}
+
+// BizEventData is the schema of the business events of experiments. Fields that don't apply to an event are left out.
+type BizEventData struct {
+	ExecutionId     float64    `json:"execution_id"`
+	ExperimentKey   string     `json:"experiment_key"`
+	ExperimentName  string     `json:"experiment_name,omitempty"`
+	State           string     `json:"state,omitempty"`
+	Environment     string     `json:"environment,omitempty"`
+	Team            string     `json:"team,omitempty"`
+	PrincipalType   string     `json:"principal_type,omitempty"`
+	PrincipalName   string     `json:"principal_name,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	DurationMs      *int64     `json:"duration_ms,omitempty"`
+	StepId          string     `json:"step_id,omitempty"`
+	ActionId        string     `json:"action_id,omitempty"`
+	ActionName      string     `json:"action_name,omitempty"`
+	ActionKind      string     `json:"action_kind,omitempty"`
+	TargetName      string     `json:"target_name,omitempty"`
+	TargetType      string     `json:"target_type,omitempty"`
+	TargetsAttacked *int       `json:"targets_attacked,omitempty"`
+	EntitySelector  string     `json:"entity_selector,omitempty"`
+	FailureReason   string     `json:"failure_reason,omitempty"`
+	Title           string     `json:"title"`
+}
+
+type MetricIngestResult struct {
+	LinesOk      int                `json:"linesOk"`
+	LinesInvalid int                `json:"linesInvalid"`
+	Error        *MetricIngestError `json:"error"`
+}
+
+type MetricIngestError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
 type EntitiesList struct {
 	Entities    []Entity `json:"entities"`
 	NextPageKey *string  `json:"nextPageKey"`
@@ -84,3 +151,45 @@ type Problem struct {
 type ProblemEntity struct {
 	Name string `json:"name"`
 }
+
+type ApiTokenLookupRequest struct {
+	Token string `json:"token"`
+}
+
+type ApiToken struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Enabled bool     `json:"enabled"`
+	Scopes  []string `json:"scopes"`
+}
+
+type QueryRequest struct {
+	Query string `json:"query"`
+}
+
+type QueryVerification struct {
+	Valid         bool                `json:"valid"`
+	Notifications []QueryNotification `json:"notifications"`
+}
+
+type QueryNotification struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type ErrorEnvelope struct {
+	Error *Error `json:"error"`
+}
+
+type Error struct {
+	Code                 int                   `json:"code"`
+	Message              string                `json:"message"`
+	ConstraintViolations []ConstraintViolation `json:"constraintViolations"`
+}
+
+type ConstraintViolation struct {
+	Path              string `json:"path"`
+	Message           string `json:"message"`
+	ParameterLocation string `json:"parameterLocation"`
+	Location          string `json:"location"`
+}